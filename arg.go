@@ -0,0 +1,215 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	err_arg_type = errors.New("unsupported type")
+
+	arg_encoders_mu sync.RWMutex
+	arg_encoders    []ArgEncoder
+)
+
+// ArgEncoder converts a command argument of a type that is not supported
+// natively into one that is. It returns ok false to leave the argument to
+// the next encoder.
+type ArgEncoder func(arg interface{}) (v interface{}, ok bool, err error)
+
+// RegisterArgEncoder adds an encoder for command arguments, encoders are
+// tried in the order they are registered, after the basic types but before
+// the built-in conversions:
+//
+//   - time.Duration, in milliseconds as PX and PEXPIRE expect, not in the
+//     seconds of EX, EXPIRE, SETEX or BLPOP
+//   - time.Time, in RFC 3339 format
+//   - *big.Int, in base 10
+//   - encoding.TextMarshaler, encoding.BinaryMarshaler and fmt.Stringer
+//
+// The value an encoder returns is written by the built-in conversions
+// only, it is not passed to the encoders again.
+func RegisterArgEncoder(fn ArgEncoder) {
+	arg_encoders_mu.Lock()
+	defer arg_encoders_mu.Unlock()
+	arg_encoders = append(arg_encoders[:len(arg_encoders):len(arg_encoders)], fn)
+}
+
+// send_buf_any writes the arguments that are not basic types:
+//
+//   - values of registered encoders
+//   - time.Duration, in milliseconds as PX and PEXPIRE expect, EX and
+//     EXPIRE take seconds and must be given an integer instead
+//   - time.Time, in RFC 3339 format
+//   - *big.Int, in base 10
+//   - encoding.TextMarshaler, encoding.BinaryMarshaler and fmt.Stringer
+//   - types derived from basic types, e.g. type Level int
+//   - slices, arrays and maps, flattened into one argument per element, or
+//     per key and value
+func send_buf_any(buf *bytes.Buffer, arg interface{}) (int, error) {
+
+	arg_encoders_mu.RLock()
+	encoders := arg_encoders
+	arg_encoders_mu.RUnlock()
+
+	for _, fn := range encoders {
+		v, ok, err := fn(arg)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return send_buf_encoded(buf, v)
+		}
+	}
+
+	return send_buf_conv(buf, arg)
+}
+
+// send_buf_encoded writes the value returned by an encoder without the
+// encoders, one returning a type it encodes itself would recurse forever.
+func send_buf_encoded(buf *bytes.Buffer, v interface{}) (int, error) {
+	switch v.(type) {
+	case []byte, string, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64, bool, nil:
+		return send_buf_arg(buf, v)
+	}
+	return send_buf_conv(buf, v)
+}
+
+func send_buf_conv(buf *bytes.Buffer, arg interface{}) (int, error) {
+
+	var s string
+
+	switch argt := arg.(type) {
+
+	case time.Duration:
+		s = strconv.FormatInt(argt.Milliseconds(), 10)
+
+	case time.Time:
+		s = argt.Format(time.RFC3339Nano)
+
+	case *big.Int:
+		if argt == nil {
+			return 0, err_arg_type
+		}
+		s = argt.String()
+
+	case encoding.TextMarshaler:
+		bs, err := argt.MarshalText()
+		if err != nil {
+			return 0, err
+		}
+		send_buf_bs(buf, bs)
+		return 1, nil
+
+	case encoding.BinaryMarshaler:
+		bs, err := argt.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+		send_buf_bs(buf, bs)
+		return 1, nil
+
+	case fmt.Stringer:
+		s = argt.String()
+
+	default:
+		return send_buf_reflect(buf, reflect.ValueOf(arg))
+	}
+
+	send_buf_ss(buf, &s)
+
+	return 1, nil
+}
+
+func send_buf_reflect(buf *bytes.Buffer, rv reflect.Value) (int, error) {
+
+	var s string
+
+	switch rv.Kind() {
+
+	case reflect.String:
+		s = rv.String()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), 10)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(rv.Uint(), 10)
+
+	case reflect.Float32:
+		s = strconv.FormatFloat(rv.Float(), 'f', -1, 32)
+
+	case reflect.Float64:
+		s = strconv.FormatFloat(rv.Float(), 'f', -1, 64)
+
+	case reflect.Bool:
+		return send_buf_arg(buf, rv.Bool())
+
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return 0, err_arg_type
+		}
+		return send_buf_arg(buf, rv.Elem().Interface())
+
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			bs := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(bs), rv)
+			send_buf_bs(buf, bs)
+			return 1, nil
+		}
+		num := 0
+		for i := 0; i < rv.Len(); i++ {
+			n, err := send_buf_arg(buf, rv.Index(i).Interface())
+			if err != nil {
+				return 0, err
+			}
+			num += n
+		}
+		return num, nil
+
+	case reflect.Map:
+		num := 0
+		for it := rv.MapRange(); it.Next(); {
+			n, err := send_buf_arg(buf, it.Key().Interface())
+			if err != nil {
+				return 0, err
+			}
+			n2, err := send_buf_arg(buf, it.Value().Interface())
+			if err != nil {
+				return 0, err
+			}
+			num += n + n2
+		}
+		return num, nil
+
+	default:
+		return 0, err_arg_type
+	}
+
+	send_buf_ss(buf, &s)
+
+	return 1, nil
+}
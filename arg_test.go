@@ -0,0 +1,149 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type argTestLevel int
+
+type argTestBinary struct{}
+
+func (argTestBinary) MarshalBinary() ([]byte, error) {
+	return []byte{0, 1}, nil
+}
+
+type argTestStringer struct{}
+
+func (argTestStringer) String() string {
+	return "stringer"
+}
+
+// encoded by argTestEncoder as itself
+type argTestSelf struct{}
+
+// encoded by argTestEncoder as a slice
+type argTestPair struct{ a, b string }
+
+func argTestEncoder(arg interface{}) (interface{}, bool, error) {
+	switch v := arg.(type) {
+	case argTestSelf:
+		return v, true, nil
+	case argTestPair:
+		return []string{v.a, v.b}, true, nil
+	}
+	return nil, false, nil
+}
+
+// test_args returns the arguments of the command written for args.
+func test_args(t *testing.T, args ...interface{}) ([]string, error) {
+
+	buf, err := send_buf_cmd("cmd", args)
+	if err != nil {
+		return nil, err
+	}
+
+	ls, err := test_read_cmd(bufio.NewReader(bytes.NewReader(buf)))
+	if err != nil {
+		t.Fatalf("%q: %v", buf, err)
+	}
+
+	return ls[1:], nil
+}
+
+func init() {
+	RegisterArgEncoder(argTestEncoder)
+}
+
+func TestSendBufArg(t *testing.T) {
+
+	n := 7
+	tm := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	num, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	for _, v := range []struct {
+		arg  interface{}
+		want []string
+	}{
+		// basic types
+		{"a", []string{"a"}},
+		{[]byte("raw"), []string{"raw"}},
+		{-1, []string{"-1"}},
+		{uint8(255), []string{"255"}},
+		{1.5, []string{"1.5"}},
+		{true, []string{"1"}},
+		{nil, []string{""}},
+
+		// slices, arrays and maps, flattened
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]int{1, 2}, []string{"1", "2"}},
+		{[2]string{"a", "b"}, []string{"a", "b"}},
+		{[]interface{}{"a", 1, []byte("b")}, []string{"a", "1", "b"}},
+		{[][]string{{"a"}, {"b", "c"}}, []string{"a", "b", "c"}},
+		{[]string{}, []string{}},
+		{map[string]int{"k": 1}, []string{"k", "1"}},
+
+		// built-in conversions
+		{1500 * time.Millisecond, []string{"1500"}},
+		{tm, []string{"2024-05-06T07:08:09.00000001Z"}},
+		{num, []string{"123456789012345678901234567890"}},
+		{net.ParseIP("10.0.0.1"), []string{"10.0.0.1"}},
+		{argTestBinary{}, []string{"\x00\x01"}},
+		{argTestStringer{}, []string{"stringer"}},
+		{argTestLevel(3), []string{"3"}},
+		{&n, []string{"7"}},
+
+		// registered encoders
+		{argTestPair{"x", "y"}, []string{"x", "y"}},
+		{[]argTestPair{{"x", "y"}}, []string{"x", "y"}},
+	} {
+		ls, err := test_args(t, v.arg)
+		if err != nil {
+			t.Fatalf("%T: %v", v.arg, err)
+		}
+		if strings.Join(ls, ",") != strings.Join(v.want, ",") || len(ls) != len(v.want) {
+			t.Fatalf("%T: %q, want %q", v.arg, ls, v.want)
+		}
+	}
+}
+
+func TestSendBufArgError(t *testing.T) {
+
+	var np *int
+
+	for _, v := range []struct {
+		args []interface{}
+		msg  string
+	}{
+		{[]interface{}{"k", make(chan int)}, "bad argument 1 (chan int)"},
+		{[]interface{}{"k", "v", (*big.Int)(nil)}, "bad argument 2 (*big.Int)"},
+		{[]interface{}{np}, "bad argument 0 (*int)"},
+		{[]interface{}{"k", []interface{}{"a", func() {}}}, "bad argument 1 ([]interface {})"},
+		{[]interface{}{argTestSelf{}}, "bad argument 0 (redisgo.argTestSelf)"},
+	} {
+		_, err := test_args(t, v.args...)
+		if err == nil || !strings.HasPrefix(err.Error(), v.msg) || !errors.Is(err, err_arg_type) {
+			t.Fatalf("%v: error %v, want %s", v.args, err, v.msg)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"sync"
+)
+
+var async_batch_max = 1024
+
+// Future is the pending Result of a command sent by CmdAsync.
+type Future struct {
+	cmd  string
+	args []interface{}
+	rs   *Result
+	done chan struct{}
+}
+
+// Wait blocks until the reply is read and returns its Result.
+func (f *Future) Wait() *Result {
+	<-f.done
+	return f.rs
+}
+
+// Done is closed once the Result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+type asyncQueue struct {
+	mu       sync.Mutex
+	pending  []*Future
+	flushers int
+}
+
+// CmdAsync queues a command and returns right away. The commands queued
+// meanwhile are sent on one connection with a single write, and their
+// replies are matched in FIFO order, as a Pipeline does. A batch is sent
+// as soon as a connection is free, up to MaxOpen batches at a time.
+//
+// args must not be modified until the Future is done.
+func (c *Connector) CmdAsync(cmd string, args ...interface{}) *Future {
+
+	f := &Future{
+		cmd:  cmd,
+		args: args,
+		done: make(chan struct{}),
+	}
+
+	q := &c.async
+	q.mu.Lock()
+	q.pending = append(q.pending, f)
+	start := q.flushers < c.cfg.MaxOpen &&
+		(q.flushers == 0 || len(q.pending) >= async_batch_max)
+	if start {
+		q.flushers++
+	}
+	q.mu.Unlock()
+
+	if start {
+		go c.async_flush()
+	}
+
+	return f
+}
+
+// async_flush sends the queued commands in batches until the queue is
+// empty.
+func (c *Connector) async_flush() {
+
+	q := &c.async
+
+	for {
+
+		q.mu.Lock()
+		n := min(len(q.pending), async_batch_max)
+		if n == 0 {
+			q.flushers--
+			q.mu.Unlock()
+			return
+		}
+		batch := q.pending[:n:n]
+		if q.pending = q.pending[n:]; len(q.pending) == 0 {
+			q.pending = nil
+		}
+		q.mu.Unlock()
+
+		p := c.Pipeline()
+		for _, f := range batch {
+			p.Cmd(f.cmd, f.args...)
+		}
+
+		rss, err := p.ExecContext(context.Background())
+
+		for i, f := range batch {
+			if err != nil {
+				f.rs = async_result(err)
+			} else {
+				f.rs = rss[i]
+			}
+			close(f.done)
+		}
+	}
+}
+
+func async_result(err error) *Result {
+	switch err {
+	case err_pool_timeout, err_pool_closed:
+		return pool_result(err)
+	}
+	return net_result(err)
+}
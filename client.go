@@ -17,7 +17,9 @@ package redisgo // import "github.com/lynkdb/redisgo"
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
 	"time"
@@ -34,67 +36,350 @@ type client struct {
 	sock   net.Conn
 	reader *bufio.Reader
 	copts  *connOptions
+	gen    uint64
+	ctime  time.Time
+	atime  time.Time
+	stats  *poolStats
+	nw     int64
+	nr     int64
 }
 
-func newClient(copts *connOptions) (*client, error) {
+// sockReader counts the bytes read from the socket.
+type sockReader struct {
+	sock net.Conn
+	n    *int64
+}
 
-	sock, err := net.Dial(copts.net, copts.addr)
-	if err != nil {
-		return nil, err
+func (r *sockReader) Read(bs []byte) (int, error) {
+	n, err := r.sock.Read(bs)
+	*r.n += int64(n)
+	return n, err
+}
+
+// nread returns the number of bytes consumed by the parser, the bytes read
+// ahead in the buffer are not counted yet.
+func (c *client) nread() int64 {
+	if c.reader == nil {
+		return c.nr
 	}
+	return c.nr - int64(c.reader.Buffered())
+}
+
+func newClient(copts *connOptions) (*client, error) {
 
 	cli := &client{
-		sock:   sock,
-		reader: bufio.NewReaderSize(sock, bufio_size),
-		copts:  copts,
+		copts: copts,
 	}
 
-	if copts.auth != "" {
-		cli.sock.SetDeadline(time.Now().Add(cli.copts.timeout))
-		if rs := cli.Cmd("auth", copts.auth); !rs.OK() {
-			return nil, err_auth
-		}
+	if err := cli.connect(context.Background()); err != nil {
+		return nil, err
 	}
 
 	return cli, nil
 }
 
-func (c *client) Cmd(cmd string, args ...interface{}) *Result {
+func (c *client) connect(ctx context.Context) error {
 
-	buf, err := send_buf_cmd(cmd, args)
+	network, addr, gen := c.copts.address()
+
+	hooks := c.copts.hook_list()
+	if len(hooks) == 0 {
+		return c.dial(ctx, network, addr, gen)
+	}
+
+	ev := &HookEvent{
+		Cmd:  "dial",
+		Addr: addr,
+	}
+	ctx = hook_before_dial(ctx, hooks, ev)
+
+	tn, nw, nr := time.Now(), c.nw, c.nr
+	err := c.dial(ctx, network, addr, gen)
+
+	ev.Duration, ev.Err = time.Since(tn), err
+	ev.BytesWritten, ev.BytesRead = c.nw-nw, c.nr-nr
+	switch {
+	case err == nil:
+		ev.Status = ResultOK
+	case errors.Is(err, err_auth):
+		ev.Status = ResultNoAuth
+	default:
+		ev.Status = ResultNetworkException
+	}
+
+	hook_after_dial(ctx, hooks, ev)
+
+	return err
+}
+
+// dial opens the socket, then authenticates and sets up the connection.
+func (c *client) dial(ctx context.Context, network, addr string, gen uint64) error {
+
+	dialer := &net.Dialer{
+		Timeout: c.copts.timeout,
+	}
+
+	sock, err := dialer.DialContext(ctx, network, addr)
 	if err != nil {
-		return newResult(ResultBadArgument, err)
+		return err
 	}
 
-	if c.sock == nil {
-		sock, err := net.Dial(c.copts.net, c.copts.addr)
+	if c.copts.tls != nil && network == "tcp" {
+		tsock, err := c.copts.tls.handshake(ctx, sock, addr, c.copts.timeout)
 		if err != nil {
-			return newResult(ResultNetworkException, err)
+			sock.Close()
+			return err
 		}
-		c.sock = sock
-		c.reader = bufio.NewReaderSize(sock, bufio_size)
+		sock = tsock
+	}
 
-		if c.copts.auth != "" {
-			if rs := c.Cmd("auth", c.copts.auth); !rs.OK() {
-				return newResult(ResultNoAuth, err_auth)
+	c.sock = sock
+	c.gen = gen
+	c.ctime = time.Now()
+	c.reader = bufio.NewReaderSize(&sockReader{sock, &c.nr}, bufio_size)
+
+	user, pass, err := c.copts.credentials()
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("%w: %s", err_auth, err.Error())
+	}
+
+	if c.copts.proto == 3 {
+		args := []interface{}{3}
+		if pass != "" {
+			if user == "" {
+				user = "default"
+			}
+			args = append(args, "auth", user, pass)
+		}
+		if rs := c.CmdContext(ctx, "hello", args...); !rs.OK() {
+			c.Close()
+			if rs.Status == ResultCanceled {
+				return ctx.Err()
+			}
+			if pass != "" {
+				return fmt.Errorf("%w: %w", err_auth, rs.Err())
+			}
+			return rs.Err()
+		}
+	} else if pass != "" {
+		args := []interface{}{pass}
+		if user != "" {
+			args = []interface{}{user, pass}
+		}
+		if rs := c.CmdContext(ctx, "auth", args...); !rs.OK() {
+			c.Close()
+			if rs.Status == ResultCanceled {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %w", err_auth, rs.Err())
+		}
+	}
+
+	if c.copts.db > 0 {
+		if rs := c.CmdContext(ctx, "select", c.copts.db); !rs.OK() {
+			c.Close()
+			if rs.Status == ResultCanceled {
+				return ctx.Err()
 			}
+			return fmt.Errorf("select %d: %w", c.copts.db, rs.Err())
 		}
 	}
 
-	c.sock.SetDeadline(time.Now().Add(c.copts.timeout))
+	for _, s := range c.copts.script_list() {
+		if rs := c.CmdContext(ctx, "script", "load", s.src); !rs.OK() {
+			c.Close()
+			if rs.Status == ResultCanceled {
+				return ctx.Err()
+			}
+			return fmt.Errorf("script load %s: %w", s.hash, rs.Err())
+		}
+	}
+
+	if c.copts.init != nil {
+		if err := c.copts.init(&Conn{cli: c, ctx: ctx}); err != nil {
+			c.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Conn is a single connection of the pool, it is passed to
+// Config.OnConnect to set up every new connection.
+type Conn struct {
+	cli *client
+	ctx context.Context
+}
+
+func (c *Conn) Cmd(cmd string, args ...interface{}) *Result {
+	return c.cli.CmdContext(c.ctx, cmd, args...)
+}
+
+func (c *client) Cmd(cmd string, args ...interface{}) *Result {
+	return c.CmdContext(context.Background(), cmd, args...)
+}
+
+func (c *client) CmdContext(ctx context.Context, cmd string, args ...interface{}) *Result {
+
+	buf, err := send_buf_cmd(cmd, args)
+	if err != nil {
+		return newResult(ResultBadArgument, err)
+	}
+
+	if rs := c.reconnect(ctx); rs != nil {
+		return rs
+	}
+
+	done := c.deadline(ctx)
+	defer done()
+
+	c.nw += int64(len(buf))
 	if _, err = c.sock.Write(buf); err != nil {
-		return newResult(ResultNetworkException, err)
+		return c.ctx_result(ctx, err)
 	}
 
 	rs, err := c.cmd_parse()
 	if err != nil {
-		if ev, ok := err.(*net.OpError); ok && ev.Timeout() {
-			return newResult(ResultTimeout, err)
+		return c.ctx_result(ctx, err)
+	}
+
+	return rs
+}
+
+// Pipeline writes every queued command in buf with a single write and
+// reads back num replies in order. The size in bytes of each reply is set
+// in sizes if it is not nil.
+func (c *client) Pipeline(ctx context.Context, buf []byte, num int, sizes []int64) ([]*Result, error) {
+
+	if rs := c.reconnect(ctx); rs != nil {
+		return nil, rs.Err()
+	}
+
+	done := c.deadline(ctx)
+	defer done()
+
+	c.nw += int64(len(buf))
+	if _, err := c.sock.Write(buf); err != nil {
+		c.Close()
+		return nil, ctx_error(ctx, err)
+	}
+
+	ls := make([]*Result, 0, num)
+	for i := 0; i < num; i++ {
+		nr := c.nread()
+		rs, err := c.cmd_parse()
+		if err != nil {
+			// the stream is out of sync once a reply is lost
+			c.Close()
+			return nil, ctx_error(ctx, err)
+		}
+		if sizes != nil {
+			sizes[i] = c.nread() - nr
+		}
+		ls = append(ls, rs)
+	}
+
+	return ls, nil
+}
+
+func (c *client) reconnect(ctx context.Context) *Result {
+
+	if c.sock != nil {
+		return nil
+	}
+
+	if c.stats != nil && !c.ctime.IsZero() {
+		c.stats.reconnects.Add(1)
+	}
+
+	if err := c.connect(ctx); err != nil {
+		if err := ctx_err(ctx); err != nil {
+			return newResult(ResultCanceled, err)
+		}
+		if errors.Is(err, err_auth) {
+			return newResult(ResultNoAuth, err)
 		}
 		return newResult(ResultNetworkException, err)
 	}
 
-	return rs
+	return nil
+}
+
+// deadline sets the socket deadline to the configured timeout, or to the
+// deadline of ctx if it is earlier, and interrupts any blocking read or
+// write once ctx is canceled. The returned func must be called when the
+// I/O is done.
+func (c *client) deadline(ctx context.Context) func() {
+
+	tto := time.Now().Add(c.copts.timeout)
+	if v, ok := ctx.Deadline(); ok && v.Before(tto) {
+		tto = v
+	}
+	c.sock.SetDeadline(tto)
+
+	cancel := ctx.Done()
+	if cancel == nil {
+		return func() {}
+	}
+
+	var (
+		sock = c.sock
+		stop = make(chan struct{})
+		exit = make(chan struct{})
+	)
+
+	go func() {
+		defer close(exit)
+		select {
+		case <-cancel:
+			sock.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-exit
+	}
+}
+
+// ctx_result maps an I/O error to a Result. A failed or canceled request
+// may leave an unread reply on the socket, so the connection is closed and
+// re-dialed on next use.
+func (c *client) ctx_result(ctx context.Context, err error) *Result {
+	c.Close()
+	if err := ctx_err(ctx); err != nil {
+		return newResult(ResultCanceled, err)
+	}
+	return net_result(err)
+}
+
+func ctx_error(ctx context.Context, err error) error {
+	if err := ctx_err(ctx); err != nil {
+		return err
+	}
+	return err
+}
+
+// ctx_err is ctx.Err(), but also reports an expired deadline that the
+// socket timed out on before the context timer fired.
+func ctx_err(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tto, ok := ctx.Deadline(); ok && !time.Now().Before(tto) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func net_result(err error) *Result {
+	if ev, ok := err.(*net.OpError); ok && ev.Timeout() {
+		return newResult(ResultTimeout, err)
+	}
+	return newResult(ResultNetworkException, err)
 }
 
 func cmd_parse_read(reader *bufio.Reader, size int) ([]byte, error) {
@@ -119,129 +404,191 @@ func (c *client) cmd_parse() (*Result, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(bs) < 4 {
+	if len(bs) < 3 {
 		return nil, err_parse
 	}
 
-	rs := newResult(0, nil)
+	rs := &Result{}
+	if err := cmd_parse_value(rs, bs, c.reader); err != nil {
+		return nil, err
+	}
+
+	// Pushes are out of band data in RESP3, e.g. client tracking
+	// invalidations, and are skipped while waiting for a reply
+	if rs.typ == '>' {
+		return c.cmd_parse()
+	}
+
+	return rs, nil
+}
+
+func cmd_parse_array(rs *Result, reader *bufio.Reader) error {
+
+	for i := 0; i < rs.cap; i++ {
+
+		bs, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		if len(bs) < 3 {
+			return err_parse
+		}
+
+		rs2 := &Result{}
+		if err := cmd_parse_value(rs2, bs, reader); err != nil {
+			return err
+		}
+		rs.Items = append(rs.Items, rs2)
+	}
+
+	return nil
+}
+
+// cmd_parse_value decodes a reply of type bs[0] with the header line bs
+// into rs and sets its status, aggregate types are decoded recursively and
+// an error inside of them is an item with the ResultError status.
+func cmd_parse_value(rs *Result, bs []byte, reader *bufio.Reader) error {
+
+	rs.typ = bs[0]
 
 	switch bs[0] {
 
 	// Errors
 	case '-':
 		rs.data = bytes_clone(bs[1 : len(bs)-2])
-		rs.cap = 0
 		rs.Status = ResultError
+		return nil
+
+	// Blob Errors
+	case '!':
+		size, err := cmd_parse_size(bs)
+		if err != nil || size < 0 {
+			return err_parse
+		}
+		if rs.data, err = cmd_parse_bulk(reader, size); err != nil {
+			return err
+		}
+		rs.Status = ResultError
+		return nil
 
-	// Simple Strings, Integers
-	case '+', ':':
+	// Simple Strings, Integers, Doubles, Booleans, Big Numbers
+	case '+', ':', ',', '#', '(':
 		rs.data = bytes_clone(bs[1 : len(bs)-2])
 		rs.cap = 1
 
-	// Bulk Strings
-	case '$':
-		size, err := strconv.Atoi(string(bs[1 : len(bs)-2]))
-		if err != nil || size < -1 {
-			return nil, err_parse
+	// Null
+	case '_':
+		rs.null = true
+
+	// Bulk Strings, Verbatim Strings
+	case '$', '=':
+		size, err := cmd_parse_size(bs)
+		if err != nil {
+			return err
 		}
 		if size > 0 {
-			bs2, err := cmd_parse_read(c.reader, size+2)
-			if err != nil {
-				return nil, err
+			if rs.data, err = cmd_parse_bulk(reader, size); err != nil {
+				return err
+			}
+			if bs[0] == '=' {
+				// skip the format prefix, e.g. "txt:"
+				if len(rs.data) < 4 {
+					return err_parse
+				}
+				rs.data = rs.data[4:]
 			}
-			rs.data = bytes_clone(bs2[:len(bs2)-2])
 			rs.cap = 1
+		} else if size == 0 {
+			// the empty string is still followed by CRLF
+			if _, err := cmd_parse_bulk(reader, 0); err != nil {
+				return err
+			}
+			rs.data = []byte{}
 		} else {
-			rs.cap = 0
+			rs.null = true
 		}
 
-	// Array
-	case '*':
-		size, err := strconv.Atoi(string(bs[1 : len(bs)-2]))
-		if err != nil || size < -1 {
-			return nil, err_parse
+	// Arrays, Sets, Pushes
+	case '*', '~', '>':
+		size, err := cmd_parse_size(bs)
+		if err != nil {
+			return err
 		}
-
-		rs.cap = size
-		if err = cmd_parse_array(rs, c.reader); err != nil {
-			return nil, err
+		if size > 0 {
+			rs.cap = size
+			if err := cmd_parse_array(rs, reader); err != nil {
+				return err
+			}
+		} else if size < 0 {
+			rs.null = true
 		}
 
-	// protocol error
-	default:
-		return nil, err_parse
-	}
-
-	if rs.Status == 0 {
-		if rs.cap == 0 || (len(rs.data) == 0 && len(rs.Items) == 0) {
-			rs.Status = ResultNotFound
-		} else if (rs.cap == 1 && len(rs.data) > 0) || len(rs.Items) >= rs.cap {
-			rs.Status = ResultOK
-		} else {
-			rs.Status = ResultUnknown
+	// Maps, decoded as a flat key/value list like HGETALL in RESP2
+	case '%':
+		size, err := cmd_parse_size(bs)
+		if err != nil {
+			return err
+		}
+		if size > 0 {
+			rs.cap = size * 2
+			if err := cmd_parse_array(rs, reader); err != nil {
+				return err
+			}
+		} else if size < 0 {
+			rs.null = true
 		}
-	}
-
-	return rs, nil
-}
-
-func cmd_parse_array(rs *Result, reader *bufio.Reader) error {
-
-	for i := 0; i < rs.cap; i++ {
 
-		bs, err := reader.ReadBytes('\n')
+	// Attributes, attached to the reply that follows them
+	case '|':
+		attrs := &Result{}
+		bs[0] = '%'
+		if err := cmd_parse_value(attrs, bs, reader); err != nil {
+			return err
+		}
+		bs2, err := reader.ReadBytes('\n')
 		if err != nil {
 			return err
 		}
-		if len(bs) < 4 {
+		if len(bs2) < 3 {
 			return err_parse
 		}
+		if err := cmd_parse_value(rs, bs2, reader); err != nil {
+			return err
+		}
+		rs.attrs = attrs
+		return nil
 
-		switch bs[0] {
-
-		// Bulk Strings
-		case '$':
-			size, err := strconv.Atoi(string(bs[1 : len(bs)-2]))
-			if err != nil || size < -1 {
-				return err_parse
-			}
-			if size > 0 {
-				bs2, err := cmd_parse_read(reader, size+2)
-				if err != nil {
-					return err
-				}
-				rs.Items = append(rs.Items, &Result{
-					data: bytes_clone(bs2[:(len(bs2) - 2)]),
-					cap:  1,
-				})
-			} else {
-				rs.Items = append(rs.Items, &Result{
-					cap: 0,
-				})
-			}
+	// protocol error
+	default:
+		return err_parse
+	}
 
-		// Array
-		case '*':
-			size, err := strconv.Atoi(string(bs[1 : len(bs)-2]))
-			if err != nil || size < -1 {
-				return err_parse
-			}
+	// empty strings and arrays are OK, only nil replies are NotFound
+	if rs.null {
+		rs.Status = ResultNotFound
+	} else if rs.Items == nil || len(rs.Items) >= rs.cap {
+		rs.Status = ResultOK
+	} else {
+		rs.Status = ResultUnknown
+	}
 
-			rs2 := &Result{cap: size}
-			if size > 0 {
-				if err := cmd_parse_array(rs2, reader); err != nil {
-					return err
-				}
-			}
-			rs.Items = append(rs.Items, rs2)
+	return nil
+}
 
-		// protocol error
-		default:
-			return err_parse
-		}
+func cmd_parse_size(bs []byte) (int, error) {
+	size, err := strconv.Atoi(string(bs[1 : len(bs)-2]))
+	if err != nil || size < -1 {
+		return 0, err_parse
 	}
+	return size, nil
+}
 
-	return nil
+func cmd_parse_bulk(reader *bufio.Reader, size int) ([]byte, error) {
+	bs, err := cmd_parse_read(reader, size+2)
+	if err != nil {
+		return nil, err
+	}
+	return bs[:size], nil
 }
 
 func (c *client) Close() error {
@@ -254,81 +601,100 @@ func (c *client) Close() error {
 
 func send_buf_cmd(cmd string, args []interface{}) ([]byte, error) {
 
+	var (
+		body bytes.Buffer
+		num  = 1
+	)
+
+	send_buf_ss(&body, &cmd)
+
+	for i, arg := range args {
+		n, err := send_buf_arg(&body, arg)
+		if err != nil {
+			return []byte{}, fmt.Errorf("bad argument %d (%T): %w", i, arg, err)
+		}
+		num += n
+	}
+
 	var buf bytes.Buffer
+	buf.Grow(body.Len() + 16)
 
 	buf.WriteByte('*')
-	buf.Write([]byte(strconv.Itoa(len(args) + 1)))
+	buf.WriteString(strconv.Itoa(num))
 	buf.Write(delim)
+	buf.Write(body.Bytes())
 
-	send_buf_ss(&buf, &cmd)
-
-	for _, arg := range args {
-
-		var s string
+	return buf.Bytes(), nil
+}
 
-		switch argt := arg.(type) {
+// send_buf_arg writes arg as bulk strings and returns their number, slices
+// and maps are written as one bulk string per element.
+func send_buf_arg(buf *bytes.Buffer, arg interface{}) (int, error) {
 
-		case []byte:
-			send_buf_bs(&buf, argt)
-			continue
+	var s string
 
-		case string:
-			s = argt
+	switch argt := arg.(type) {
 
-		case int:
-			s = strconv.FormatInt(int64(argt), 10)
+	case []byte:
+		send_buf_bs(buf, argt)
+		return 1, nil
 
-		case int8:
-			s = strconv.FormatInt(int64(argt), 10)
+	case string:
+		s = argt
 
-		case int16:
-			s = strconv.FormatInt(int64(argt), 10)
+	case int:
+		s = strconv.FormatInt(int64(argt), 10)
 
-		case int32:
-			s = strconv.FormatInt(int64(argt), 10)
+	case int8:
+		s = strconv.FormatInt(int64(argt), 10)
 
-		case int64:
-			s = strconv.FormatInt(argt, 10)
+	case int16:
+		s = strconv.FormatInt(int64(argt), 10)
 
-		case uint:
-			s = strconv.FormatUint(uint64(argt), 10)
+	case int32:
+		s = strconv.FormatInt(int64(argt), 10)
 
-		case uint8:
-			s = strconv.FormatUint(uint64(argt), 10)
+	case int64:
+		s = strconv.FormatInt(argt, 10)
 
-		case uint16:
-			s = strconv.FormatUint(uint64(argt), 10)
+	case uint:
+		s = strconv.FormatUint(uint64(argt), 10)
 
-		case uint32:
-			s = strconv.FormatUint(uint64(argt), 10)
+	case uint8:
+		s = strconv.FormatUint(uint64(argt), 10)
 
-		case uint64:
-			s = strconv.FormatUint(argt, 10)
+	case uint16:
+		s = strconv.FormatUint(uint64(argt), 10)
 
-		case float32:
-			s = strconv.FormatFloat(float64(argt), 'f', -1, 32)
+	case uint32:
+		s = strconv.FormatUint(uint64(argt), 10)
 
-		case float64:
-			s = strconv.FormatFloat(argt, 'f', -1, 64)
+	case uint64:
+		s = strconv.FormatUint(argt, 10)
 
-		case bool:
-			if argt {
-				s = "1"
-			} else {
-				s = "0"
-			}
+	case float32:
+		s = strconv.FormatFloat(float64(argt), 'f', -1, 32)
 
-		case nil:
-			s = ""
+	case float64:
+		s = strconv.FormatFloat(argt, 'f', -1, 64)
 
-		default:
-			return []byte{}, errors.New("bad arguments")
+	case bool:
+		if argt {
+			s = "1"
+		} else {
+			s = "0"
 		}
 
-		send_buf_ss(&buf, &s)
+	case nil:
+		s = ""
+
+	default:
+		return send_buf_any(buf, arg)
 	}
 
-	return buf.Bytes(), nil
+	send_buf_ss(buf, &s)
+
+	return 1, nil
 }
 
 func send_buf_bs(buf *bytes.Buffer, data []byte) {
@@ -0,0 +1,203 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// test_describe prints a reply as nil, -error, "" for an empty string,
+// the value of other scalars, or the items of an aggregate in brackets
+// prefixed by its type.
+func test_describe(rs *Result) string {
+
+	switch {
+	case rs.IsNil():
+		return "nil"
+	case rs.Status == ResultError:
+		return "-" + rs.String()
+	}
+
+	prefix := ""
+	switch rs.Kind() {
+	case KindMap:
+		prefix = "%"
+	case KindSet:
+		prefix = "~"
+	case KindPush:
+		prefix = ">"
+	case KindArray:
+	default:
+		if len(rs.data) == 0 {
+			return `""`
+		}
+		return rs.String()
+	}
+
+	ls := make([]string, len(rs.Items))
+	for i, v := range rs.Items {
+		ls[i] = test_describe(v)
+	}
+	return prefix + "[" + strings.Join(ls, " ") + "]"
+}
+
+func test_client(raw string) *client {
+	return &client{
+		reader: bufio.NewReader(strings.NewReader(raw)),
+	}
+}
+
+// test_parse parses one reply of raw, pushes included, and returns the
+// reader to check what is left.
+func test_parse(raw string) (*Result, *bufio.Reader, error) {
+
+	r := bufio.NewReader(strings.NewReader(raw))
+	bs, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, r, err
+	}
+	if len(bs) < 3 {
+		return nil, r, err_parse
+	}
+
+	rs := &Result{}
+	err = cmd_parse_value(rs, bs, r)
+
+	return rs, r, err
+}
+
+func TestCmdParseValue(t *testing.T) {
+
+	for _, v := range []struct {
+		raw    string
+		kind   Kind
+		status uint8
+		desc   string
+	}{
+		// empty and nil strings
+		{"$0\r\n\r\n", KindBulk, ResultOK, `""`},
+		{"$-1\r\n", KindNil, ResultNotFound, "nil"},
+		{"$3\r\nfoo\r\n", KindBulk, ResultOK, "foo"},
+		{"$4\r\na\r\nb\r\n", KindBulk, ResultOK, "a\r\nb"},
+		{"+OK\r\n", KindString, ResultOK, "OK"},
+
+		// empty and nil arrays
+		{"*0\r\n", KindArray, ResultOK, "[]"},
+		{"*-1\r\n", KindNil, ResultNotFound, "nil"},
+		{"*1\r\n*0\r\n", KindArray, ResultOK, "[[]]"},
+		{"*2\r\n$0\r\n\r\n$-1\r\n", KindArray, ResultOK, `["" nil]`},
+
+		// RESP3 null
+		{"_\r\n", KindNil, ResultNotFound, "nil"},
+		{"*2\r\n_\r\n:1\r\n", KindArray, ResultOK, "[nil 1]"},
+
+		// errors, nested ones do not fail the array
+		{"-ERR bad\r\n", KindError, ResultError, "-ERR bad"},
+		{"!21\r\nSYNTAX invalid syntax\r\n", KindError, ResultError, "-SYNTAX invalid syntax"},
+		{"*3\r\n$1\r\na\r\n-ERR bad\r\n:1\r\n", KindArray, ResultOK, "[a -ERR bad 1]"},
+		{"*1\r\n*1\r\n!3\r\nERR\r\n", KindArray, ResultOK, "[[-ERR]]"},
+
+		// RESP3 scalars
+		{":-12\r\n", KindInteger, ResultOK, "-12"},
+		{",3.14\r\n", KindDouble, ResultOK, "3.14"},
+		{"#t\r\n", KindBool, ResultOK, "t"},
+		{"(3492890328409238509324850943850943825024385\r\n", KindBigNumber, ResultOK,
+			"3492890328409238509324850943850943825024385"},
+		{"=15\r\ntxt:Some string\r\n", KindVerbatim, ResultOK, "Some string"},
+		{"=4\r\ntxt:\r\n", KindVerbatim, ResultOK, `""`},
+
+		// RESP3 aggregates
+		{"%2\r\n$1\r\na\r\n:1\r\n+b\r\n_\r\n", KindMap, ResultOK, "%[a 1 b nil]"},
+		{"%0\r\n", KindMap, ResultOK, "%[]"},
+		{"~2\r\n+x\r\n+y\r\n", KindSet, ResultOK, "~[x y]"},
+		{">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n", KindPush, ResultOK, ">[message ch hi]"},
+		{"|1\r\n+ttl\r\n:3\r\n$1\r\nv\r\n", KindBulk, ResultOK, "v"},
+		{"*1\r\n|1\r\n+a\r\n+b\r\n:2\r\n", KindArray, ResultOK, "[2]"},
+	} {
+		rs, r, err := test_parse(v.raw)
+		if err != nil {
+			t.Fatalf("%q: %v", v.raw, err)
+		}
+		if rs.Kind() != v.kind || rs.Status != v.status || test_describe(rs) != v.desc {
+			t.Fatalf("%q: kind %d status %d %s, want kind %d status %d %s",
+				v.raw, rs.Kind(), rs.Status, test_describe(rs), v.kind, v.status, v.desc)
+		}
+		if n := r.Buffered(); n != 0 {
+			t.Fatalf("%q: %d bytes left", v.raw, n)
+		}
+	}
+}
+
+func TestCmdParseAttributes(t *testing.T) {
+
+	rs := test_reply(t, "|1\r\n+ttl\r\n:3\r\n$1\r\nv\r\n")
+
+	attrs := rs.Attributes()
+	if attrs == nil || attrs.Kind() != KindMap || attrs.Map()["ttl"].Int() != 3 {
+		t.Fatalf("attributes %v", attrs)
+	}
+}
+
+func TestCmdParseStream(t *testing.T) {
+
+	// replies after an empty string and a push stay in sync, the push is
+	// skipped while waiting for a reply
+	c := test_client("$0\r\n\r\n:1\r\n>2\r\n+invalidate\r\n*1\r\n$1\r\nk\r\n+OK\r\n")
+
+	for _, want := range []string{`""`, "1", "OK"} {
+		rs, err := c.cmd_parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := test_describe(rs); s != want {
+			t.Fatalf("reply %s, want %s", s, want)
+		}
+	}
+}
+
+func TestCmdParseInvalid(t *testing.T) {
+
+	for _, raw := range []string{
+
+		// truncated
+		"",
+		"$3\r\n",
+		"$3\r\nfo",
+		"$3\r\nfoo",
+		"$0\r\n",
+		"*2\r\n$1\r\na\r\n",
+		"*1\r\n",
+		"%1\r\n+a\r\n",
+		"~2\r\n+x\r\n",
+		">1\r\n",
+		"|1\r\n+a\r\n+b\r\n",
+		"!5\r\nER",
+
+		// malformed
+		"\r\n",
+		"?x\r\n",
+		"$-2\r\n",
+		"$abc\r\n",
+		"*x\r\n",
+		"=3\r\ntxt\r\n",
+		"*1\r\n\r\n",
+	} {
+		if rs, _, err := test_parse(raw); err == nil {
+			t.Fatalf("%q: parsed as %s", raw, test_describe(rs))
+		}
+	}
+}
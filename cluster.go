@@ -0,0 +1,490 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	cluster_slots        = 16384
+	cluster_redirect_max = 5
+)
+
+var (
+	err_cluster_nodes = errors.New("no cluster node available")
+	err_cluster_db    = errors.New("cluster: only db 0 is supported")
+
+	// commands without a key argument, sent to any node
+	cluster_cmd_keyless = map[string]bool{
+		"asking": true, "auth": true, "bgrewriteaof": true, "bgsave": true,
+		"client": true, "cluster": true, "command": true, "config": true,
+		"dbsize": true, "debug": true, "echo": true, "flushall": true,
+		"flushdb": true, "function": true, "hello": true, "info": true,
+		"keys": true, "lastsave": true, "latency": true, "lolwut": true,
+		"memory": true, "module": true, "ping": true, "publish": true,
+		"pubsub": true, "randomkey": true, "readonly": true,
+		"readwrite": true, "role": true, "save": true, "scan": true,
+		"script": true, "slowlog": true, "time": true, "wait": true,
+	}
+)
+
+// ClusterConnector is a client of Redis Cluster. It keeps one connection
+// pool per master node, routes every command to the node that serves the
+// hash slot of its key, and follows -MOVED and -ASK redirections.
+type ClusterConnector struct {
+	mu        sync.RWMutex
+	cfg       Config
+	seeds     []string
+	nodes     map[string]*Connector
+	slots     [cluster_slots]string
+	reloading int32
+}
+
+// NewClusterConnector creates a cluster client from the seed addresses in
+// Config.Nodes (and Config.URL or Config.Host:Config.Port if set), the slot map is
+// loaded from the first seed that answers. Config.DB must be 0.
+func NewClusterConnector(cfg Config) (*ClusterConnector, error) {
+
+	if cfg.URL != "" {
+		if err := cfg.parse_url(); err != nil {
+			return nil, err
+		}
+		cfg.URL = ""
+	}
+
+	if cfg.DB != 0 {
+		return nil, err_cluster_db
+	}
+
+	c := &ClusterConnector{
+		cfg:   cfg,
+		nodes: map[string]*Connector{},
+	}
+
+	if cfg.Host != "" && cfg.Port > 0 {
+		c.seeds = append(c.seeds, net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))))
+	}
+	c.seeds = append(c.seeds, cfg.Nodes...)
+
+	if len(c.seeds) == 0 {
+		return nil, err_cluster_nodes
+	}
+
+	if err := c.reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Cmd runs a command on the node serving the slot of its key. args are
+// written like by Connector.Cmd, so a time.Duration is in milliseconds.
+func (c *ClusterConnector) Cmd(cmd string, args ...interface{}) *Result {
+	return c.CmdContext(context.Background(), cmd, args...)
+}
+
+func (c *ClusterConnector) CmdContext(ctx context.Context, cmd string, args ...interface{}) *Result {
+
+	var (
+		slot   = -1
+		addr   = ""
+		asking = false
+	)
+
+	if key, ok := cluster_cmd_key(strings.ToLower(cmd), args); ok {
+		slot = cluster_slot(key)
+		c.mu.RLock()
+		addr = c.slots[slot]
+		c.mu.RUnlock()
+	}
+
+	var rs *Result
+
+	for try := 0; try <= cluster_redirect_max; try++ {
+
+		node, err := c.node(addr)
+		if err != nil {
+			return newResult(ResultNetworkException, err)
+		}
+
+		if asking {
+			ls, err := node.Pipeline().Cmd("asking").Cmd(cmd, args...).ExecContext(ctx)
+			if err != nil {
+				if err := ctx_err(ctx); err != nil {
+					return newResult(ResultCanceled, err)
+				}
+				return newResult(ResultNetworkException, err)
+			}
+			rs, asking = ls[1], false
+		} else {
+			rs = node.CmdContext(ctx, cmd, args...)
+		}
+
+		switch rs.Status {
+
+		case ResultError:
+			// -MOVED <slot> <host:port>, -ASK <slot> <host:port>
+			ss := strings.Fields(rs.String())
+			if len(ss) != 3 || (ss[0] != "MOVED" && ss[0] != "ASK") {
+				return rs
+			}
+			addr = ss[2]
+			if ss[0] == "ASK" {
+				asking = true
+				continue
+			}
+			if n, err := strconv.Atoi(ss[1]); err == nil && n >= 0 && n < cluster_slots {
+				c.mu.Lock()
+				c.slots[n] = addr
+				c.mu.Unlock()
+			}
+			c.reload_async()
+
+		case ResultNetworkException:
+			c.reload_async()
+			return rs
+
+		default:
+			return rs
+		}
+	}
+
+	return rs
+}
+
+func (c *ClusterConnector) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, node := range c.nodes {
+		node.Close()
+		delete(c.nodes, addr)
+	}
+}
+
+// AddHook adds a hook to the pools of all nodes, known and found later.
+func (c *ClusterConnector) AddHook(h Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg.Hooks = append(c.cfg.Hooks[:len(c.cfg.Hooks):len(c.cfg.Hooks)], h)
+	for _, node := range c.nodes {
+		node.AddHook(h)
+	}
+}
+
+// node returns the pool of addr, or of any known node if addr is empty.
+func (c *ClusterConnector) node(addr string) (*Connector, error) {
+
+	c.mu.RLock()
+	if addr == "" {
+		for _, node := range c.nodes {
+			c.mu.RUnlock()
+			return node, nil
+		}
+		if len(c.seeds) > 0 {
+			addr = c.seeds[0]
+		}
+	}
+	node, ok := c.nodes[addr]
+	c.mu.RUnlock()
+
+	if ok {
+		return node, nil
+	}
+	if addr == "" {
+		return nil, err_cluster_nodes
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	portn, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	cfg := c.cfg
+	c.mu.RUnlock()
+	cfg.Host, cfg.Port, cfg.Socket, cfg.Nodes = host, uint16(portn), "", nil
+
+	// dialed without the lock, slot lookups are not blocked meanwhile
+	if node, err = NewConnector(cfg); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node2, ok := c.nodes[addr]; ok {
+		// dialed by another caller meanwhile
+		go node.Close()
+		return node2, nil
+	}
+	c.nodes[addr] = node
+
+	// added by AddHook or LoadScripts meanwhile
+	for _, h := range c.cfg.Hooks[len(cfg.Hooks):] {
+		node.AddHook(h)
+	}
+	node.copts.add_scripts(c.cfg.Scripts[len(cfg.Scripts):])
+
+	return node, nil
+}
+
+// masters returns the pools of all of the masters in the slot map.
+func (c *ClusterConnector) masters() ([]*Connector, error) {
+
+	addrs := map[string]bool{}
+	c.mu.RLock()
+	for _, addr := range c.slots {
+		if addr != "" {
+			addrs[addr] = true
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(addrs) == 0 {
+		return nil, err_cluster_nodes
+	}
+
+	nodes := make([]*Connector, 0, len(addrs))
+	for addr := range addrs {
+		node, err := c.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func (c *ClusterConnector) reload_async() {
+	if atomic.CompareAndSwapInt32(&c.reloading, 0, 1) {
+		go func() {
+			c.reload(context.Background())
+			atomic.StoreInt32(&c.reloading, 0)
+		}()
+	}
+}
+
+// reload rebuilds the slot map from CLUSTER SLOTS, or CLUSTER SHARDS if
+// the former is not available, asking the known nodes then the seeds.
+func (c *ClusterConnector) reload(ctx context.Context) error {
+
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.nodes)+len(c.seeds))
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	addrs = append(addrs, c.seeds...)
+	c.mu.RUnlock()
+
+	err := err_cluster_nodes
+
+	for _, addr := range addrs {
+
+		node, err2 := c.node(addr)
+		if err2 != nil {
+			err = err2
+			continue
+		}
+
+		host, _, _ := net.SplitHostPort(addr)
+
+		var slots [cluster_slots]string
+		if rs := node.CmdContext(ctx, "cluster", "slots"); rs.OK() {
+			err = cluster_slots_parse(&slots, rs, host)
+		} else if rs2 := node.CmdContext(ctx, "cluster", "shards"); rs2.OK() {
+			err = cluster_shards_parse(&slots, rs2, host)
+		} else {
+			err = rs.Err()
+		}
+		if err != nil {
+			continue
+		}
+
+		masters := map[string]bool{}
+		for _, addr := range slots {
+			masters[addr] = true
+		}
+
+		c.mu.Lock()
+		c.slots = slots
+		for addr, node := range c.nodes {
+			if !masters[addr] {
+				delete(c.nodes, addr)
+				// waits for the connections still in use
+				go node.Close()
+			}
+		}
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	return err
+}
+
+// CLUSTER SLOTS: [[start, end, [host, port, id, ...], replicas...], ...]
+func cluster_slots_parse(slots *[cluster_slots]string, rs *Result, host string) error {
+
+	for _, v := range rs.Items {
+
+		if len(v.Items) < 3 || len(v.Items[2].Items) < 2 {
+			return err_parse
+		}
+
+		start, end := v.Items[0].Int(), v.Items[1].Int()
+		if start < 0 || end >= cluster_slots || start > end {
+			return err_parse
+		}
+
+		master, mhost := v.Items[2], host
+		if s := master.Items[0].String(); s != "" && s != "?" {
+			mhost = s
+		}
+		addr := net.JoinHostPort(mhost, master.Items[1].String())
+
+		for i := start; i <= end; i++ {
+			slots[i] = addr
+		}
+	}
+
+	return nil
+}
+
+// CLUSTER SHARDS: [{slots: [start, end, ...], nodes: [{ip, port, role, ...}, ...]}, ...]
+func cluster_shards_parse(slots *[cluster_slots]string, rs *Result, host string) error {
+
+	for _, v := range rs.Items {
+
+		shard := v.Map()
+		ranges, nodes := shard["slots"], shard["nodes"]
+		if ranges == nil || nodes == nil {
+			return err_parse
+		}
+
+		addr := ""
+		for _, nv := range nodes.Items {
+			node := nv.Map()
+			if node["role"] == nil || node["role"].String() != "master" {
+				continue
+			}
+			nhost := host
+			if node["ip"] != nil && node["ip"].String() != "" {
+				nhost = node["ip"].String()
+			}
+			if node["port"] != nil {
+				addr = net.JoinHostPort(nhost, node["port"].String())
+			} else if node["tls-port"] != nil {
+				addr = net.JoinHostPort(nhost, node["tls-port"].String())
+			}
+			break
+		}
+		if addr == "" {
+			continue
+		}
+
+		for i := 1; i < len(ranges.Items); i += 2 {
+			start, end := ranges.Items[i-1].Int(), ranges.Items[i].Int()
+			if start < 0 || end >= cluster_slots || start > end {
+				return err_parse
+			}
+			for j := start; j <= end; j++ {
+				slots[j] = addr
+			}
+		}
+	}
+
+	return nil
+}
+
+// cluster_cmd_key returns the key a command is routed by.
+func cluster_cmd_key(cmd string, args []interface{}) (string, bool) {
+
+	if cluster_cmd_keyless[cmd] || len(args) == 0 {
+		return "", false
+	}
+
+	switch cmd {
+
+	// EVAL script numkeys key [key ...] arg [arg ...]
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		if len(args) < 3 || cluster_arg_string(args[1]) == "0" {
+			return "", false
+		}
+		return cluster_arg_string(args[2]), true
+
+	// XREAD [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...]
+	case "xread", "xreadgroup":
+		for i, arg := range args {
+			if strings.EqualFold(cluster_arg_string(arg), "streams") && i+1 < len(args) {
+				return cluster_arg_string(args[i+1]), true
+			}
+		}
+		return "", false
+	}
+
+	return cluster_arg_string(args[0]), true
+}
+
+func cluster_arg_string(arg interface{}) string {
+	switch argt := arg.(type) {
+	case string:
+		return argt
+	case []byte:
+		return string(argt)
+	}
+	return fmt.Sprint(arg)
+}
+
+// cluster_slot returns the hash slot of key, only the substring between
+// the first { and the following } is hashed if it is not empty.
+func cluster_slot(key string) int {
+	bs := []byte(key)
+	if i := bytes.IndexByte(bs, '{'); i >= 0 {
+		if j := bytes.IndexByte(bs[i+1:], '}'); j > 0 {
+			bs = bs[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(bs) % cluster_slots)
+}
+
+// CRC16-CCITT (XMODEM), as specified by Redis Cluster
+func crc16(bs []byte) uint16 {
+	var crc uint16
+	for _, b := range bs {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,175 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCrc16(t *testing.T) {
+	if v := crc16([]byte("123456789")); v != 0x31C3 {
+		t.Fatalf("crc16 %#x", v)
+	}
+}
+
+func TestClusterSlot(t *testing.T) {
+
+	for _, v := range []struct {
+		key  string
+		hash string // the part of the key that is hashed
+	}{
+		{"foo", "foo"},
+		{"{}", "{}"},
+		{"{a}b", "a"},
+		{"a{}{b}", "a{}{b}"},
+		{"{user1000}.following", "user1000"},
+		{"foo{{bar}}zap", "{bar"},
+		{"foo{bar}{zap}", "bar"},
+		{"{bar", "{bar"},
+		{"", ""},
+	} {
+		if slot, want := cluster_slot(v.key), int(crc16([]byte(v.hash))%cluster_slots); slot != want {
+			t.Fatalf("slot of %q %d, want %d", v.key, slot, want)
+		}
+	}
+
+	// CLUSTER KEYSLOT of a real server
+	if slot := cluster_slot("foo"); slot != 12182 {
+		t.Fatalf("slot of foo %d", slot)
+	}
+	if slot := cluster_slot("somekey{bar}"); slot != 5061 {
+		t.Fatalf("slot of somekey{bar} %d", slot)
+	}
+}
+
+// cluster_test_map returns the header of a map of n entries, a flat array
+// in RESP2.
+func cluster_test_map(resp3 bool, n int) string {
+	if resp3 {
+		return "%" + strconv.Itoa(n)
+	}
+	return "*" + strconv.Itoa(n*2)
+}
+
+// CLUSTER SLOTS of a Redis 7 cluster with 3 masters, the endpoint of the
+// second is empty and unknown for the third, both mean the seed host.
+func cluster_test_slots(resp3 bool) string {
+
+	node := func(host, port string, meta ...string) []string {
+		ls := []string{"*4", "$ " + host, ":" + port, "$ " + strings.Repeat(port[4:], 40),
+			cluster_test_map(resp3, len(meta)/2)}
+		for _, s := range meta {
+			ls = append(ls, "$ "+s)
+		}
+		return ls
+	}
+
+	var ls []string
+	ls = append(ls, "*3")
+	ls = append(ls, "*4", ":0", ":5460")
+	ls = append(ls, node("127.0.0.1", "30001")...)
+	ls = append(ls, node("127.0.0.1", "30004")...)
+	ls = append(ls, "*4", ":5461", ":10922")
+	ls = append(ls, node("", "30002", "hostname", "node-2")...)
+	ls = append(ls, node("127.0.0.1", "30005")...)
+	ls = append(ls, "*3", ":10923", ":16383")
+	ls = append(ls, node("?", "30003")...)
+
+	return test_resp(ls...)
+}
+
+// CLUSTER SHARDS of a Redis 7 cluster with 2 shards, the second has two
+// slot ranges and an empty ip.
+func cluster_test_shards(resp3 bool) string {
+
+	node := func(ip, port, role string) []string {
+		return []string{
+			cluster_test_map(resp3, 6),
+			"$ id", "$ " + strings.Repeat(port[4:], 40),
+			"$ port", ":" + port,
+			"$ ip", "$ " + ip,
+			"$ endpoint", "$ " + ip,
+			"$ role", "$ " + role,
+			"$ health", "$ online",
+		}
+	}
+
+	var ls []string
+	ls = append(ls, "*2")
+	ls = append(ls, cluster_test_map(resp3, 2), "$ slots", "*2", ":0", ":8191", "$ nodes", "*2")
+	ls = append(ls, node("127.0.0.1", "30004", "replica")...)
+	ls = append(ls, node("127.0.0.1", "30001", "master")...)
+	ls = append(ls, cluster_test_map(resp3, 2), "$ slots", "*4", ":8192", ":9000", ":9001", ":16383", "$ nodes", "*1")
+	ls = append(ls, node("", "30002", "master")...)
+
+	return test_resp(ls...)
+}
+
+func TestClusterSlotsParse(t *testing.T) {
+
+	for _, resp3 := range []bool{false, true} {
+
+		var slots [cluster_slots]string
+		if err := cluster_slots_parse(&slots, test_reply(t, cluster_test_slots(resp3)), "10.0.0.9"); err != nil {
+			t.Fatal(err)
+		}
+
+		for slot, addr := range map[int]string{
+			0:     "127.0.0.1:30001",
+			5460:  "127.0.0.1:30001",
+			5461:  "10.0.0.9:30002",
+			10922: "10.0.0.9:30002",
+			10923: "10.0.0.9:30003",
+			16383: "10.0.0.9:30003",
+		} {
+			if slots[slot] != addr {
+				t.Fatalf("resp3 %v: slot %d %q, want %q", resp3, slot, slots[slot], addr)
+			}
+		}
+	}
+
+	// end slot out of range
+	var slots [cluster_slots]string
+	rs := test_reply(t, test_resp("*1", "*3", ":0", ":16384", "*2", "$ 127.0.0.1", ":30001"))
+	if err := cluster_slots_parse(&slots, rs, "10.0.0.9"); err != err_parse {
+		t.Fatalf("out of range: %v", err)
+	}
+}
+
+func TestClusterShardsParse(t *testing.T) {
+
+	for _, resp3 := range []bool{false, true} {
+
+		var slots [cluster_slots]string
+		if err := cluster_shards_parse(&slots, test_reply(t, cluster_test_shards(resp3)), "10.0.0.9"); err != nil {
+			t.Fatal(err)
+		}
+
+		for slot, addr := range map[int]string{
+			0:     "127.0.0.1:30001",
+			8191:  "127.0.0.1:30001",
+			8192:  "10.0.0.9:30002",
+			9000:  "10.0.0.9:30002",
+			9001:  "10.0.0.9:30002",
+			16383: "10.0.0.9:30002",
+		} {
+			if slots[slot] != addr {
+				t.Fatalf("resp3 %v: slot %d %q, want %q", resp3, slot, slots[slot], addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+var (
+	JsonCodec Codec = jsonCodec{}
+	GobCodec  Codec = gobCodec{}
+)
+
+// A compressed value starts with codec_format_gzip, a raw value written
+// by an earlier version with codec_format_raw, neither byte starts a JSON
+// or gob encoding. Other values are the output of the codec as is.
+const (
+	codec_format_raw  byte = 0
+	codec_format_gzip byte = 1
+)
+
+// Codec marshals the values of Connector.SetValue and Connector.GetValue,
+// it is set with Config.Codec.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// SetValue marshals v with the codec of the connector and stores it in
+// key, with an expiration of ttl if it is greater than 0.
+func (c *Connector) SetValue(key string, v interface{}, ttl time.Duration) *Result {
+	return c.SetValueContext(context.Background(), key, v, ttl)
+}
+
+func (c *Connector) SetValueContext(ctx context.Context, key string, v interface{}, ttl time.Duration) *Result {
+
+	bs, err := c.value_encode(c.cfg.Codec, v)
+	if err != nil {
+		return newResult(ResultBadArgument, err)
+	}
+
+	if ttl > 0 {
+		return c.CmdContext(ctx, "set", key, bs, "px", ttl)
+	}
+	return c.CmdContext(ctx, "set", key, bs)
+}
+
+// GetValue reads key and unmarshals it into v, which must be a pointer.
+// A missing key returns a ResultNotFound result and leaves v unchanged, a
+// value that fails to unmarshal a ResultError result.
+func (c *Connector) GetValue(key string, v interface{}) *Result {
+	return c.GetValueContext(context.Background(), key, v)
+}
+
+func (c *Connector) GetValueContext(ctx context.Context, key string, v interface{}) *Result {
+
+	rs := c.CmdContext(ctx, "get", key)
+	if !rs.OK() {
+		return rs
+	}
+
+	if err := c.value_decode(c.cfg.Codec, rs.data, v); err != nil {
+		return newResult(ResultError, err)
+	}
+
+	return rs
+}
+
+// value_encode marshals v with cc, values larger than
+// Config.CompressThreshold are compressed with gzip and prefixed with
+// codec_format_gzip.
+func (c *Connector) value_encode(cc Codec, v interface{}) ([]byte, error) {
+
+	bs, err := cc.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cfg.CompressThreshold < 1 || len(bs) <= c.cfg.CompressThreshold {
+		return bs, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(codec_format_gzip)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(bs); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// value_decode unmarshals data into v with cc, data is decompressed first
+// if its format byte says so, whatever Config.CompressThreshold is now.
+func (c *Connector) value_decode(cc Codec, data []byte, v interface{}) error {
+
+	switch {
+
+	case len(data) == 0:
+
+	case data[0] == codec_format_raw:
+		data = data[1:]
+
+	case data[0] == codec_format_gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+
+	return cc.Unmarshal(data, v)
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValueCodec(t *testing.T) {
+
+	type item struct {
+		A int
+		B string
+	}
+
+	long := item{A: 1, B: strings.Repeat("b", 100)}
+
+	for _, cc := range []Codec{JsonCodec, GobCodec} {
+		for _, threshold := range []int{0, 80} {
+
+			c := &Connector{cfg: Config{CompressThreshold: threshold}}
+
+			for _, v := range []item{{A: 1}, long} {
+				bs, err := c.value_encode(cc, v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				raw, _ := cc.Marshal(v)
+				if compressed := bs[0] == codec_format_gzip; compressed != (threshold > 0 && len(raw) > threshold) {
+					t.Fatalf("threshold %d, %d bytes compressed %v", threshold, len(bs), compressed)
+				}
+
+				// read back whatever the threshold is now
+				for _, c2 := range []*Connector{c, {}} {
+					var v2 item
+					if err := c2.value_decode(cc, bs, &v2); err != nil || v2 != v {
+						t.Fatalf("decode %+v, %v", v2, err)
+					}
+				}
+			}
+		}
+	}
+
+	// written by other clients, or with a format byte by an earlier version
+	c := &Connector{}
+	for _, data := range []string{`{"A":1}`, "\x00{\"A\":1}"} {
+		var v item
+		if err := c.value_decode(JsonCodec, []byte(data), &v); err != nil || v.A != 1 {
+			t.Fatalf("decode %q: %+v, %v", data, v, err)
+		}
+	}
+
+	if bs, _ := c.value_encode(JsonCodec, item{A: 1}); string(bs) != `{"A":1,"B":""}` {
+		t.Fatalf("raw value %q", bs)
+	}
+}
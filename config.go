@@ -14,23 +14,185 @@
 
 package redisgo // import "github.com/lynkdb/redisgo"
 
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
 type Config struct {
 
+	// Connection URL, redis://[[username]:password@]host[:port][/db] or
+	// rediss:// for TLS. Fields set in the URL override Host, Port,
+	// Username, Auth, DB and TLS
+	URL string `json:"url"`
+
 	// Database server hostname or IP. Leave blank if using unix sockets
 	Host string `json:"host"`
 
 	// Database server port. Leave blank if using unix sockets
 	Port uint16 `json:"port"`
 
+	// Username for authentication with Redis 6.0 ACL, leave blank to use
+	// the default user
+	Username string `json:"username"`
+
 	// Password for authentication
 	Auth string `json:"auth"`
 
+	// Credentials returns the username and password on every new
+	// connection, it takes precedence over Username and Auth so that
+	// short-lived tokens and rotated passwords are picked up
+	Credentials func() (username, password string, err error) `json:"-"`
+
+	// Database number, selected on every new connection
+	DB int `json:"db"`
+
+	// OnConnect is called on every new connection after authentication
+	// and SELECT, e.g. to send CLIENT SETNAME or READONLY. An error
+	// closes the connection and is returned as a connection error
+	OnConnect func(conn *Conn) error `json:"-"`
+
 	// A path of a UNIX socket file. Leave blank if using host and port
 	Socket string `json:"socket"`
 
 	// The connection timeout to a redis host (seconds)
 	Timeout int `json:"timeout"`
 
-	// Maximum number of connections
+	// Maximum number of connections, an alias of MaxOpen
 	MaxConn int `json:"maxconn"`
+
+	// Maximum number of open connections, idle and in use. Defaults to
+	// MaxConn, or 1 if neither is set
+	MaxOpen int `json:"max_open"`
+
+	// Minimum number of idle connections kept open
+	MinIdle int `json:"min_idle"`
+
+	// Time to wait for a free connection when MaxOpen connections are in
+	// use (seconds), a ResultPoolTimeout result is returned after it.
+	// Leave 0 to wait until the connection or the context is released
+	PoolTimeout int `json:"pool_timeout"`
+
+	// Idle connections above MinIdle are closed after this time (seconds)
+	IdleTimeout int `json:"idle_timeout"`
+
+	// Connections are closed after this time since they were dialed
+	// (seconds), leave 0 to keep them open
+	MaxConnLifetime int `json:"max_conn_lifetime"`
+
+	// Connections idle for longer than this time (seconds) are checked
+	// with PING when taken from the pool, leave 0 to skip the check
+	HealthCheckInterval int `json:"health_check_interval"`
+
+	// Seed addresses (host:port) of a Redis Cluster, used by
+	// NewClusterConnector
+	Nodes []string `json:"nodes"`
+
+	// Addresses (host:port) of Redis Sentinels. If set, the address of
+	// the master named MasterName is discovered from the sentinels and
+	// followed on failover, Host, Port and Socket are ignored
+	Sentinels []string `json:"sentinels"`
+
+	// Name of the master monitored by the sentinels
+	MasterName string `json:"master_name"`
+
+	// Password for authentication with the sentinels
+	SentinelAuth string `json:"sentinel_auth"`
+
+	// Send read-only commands to the replicas reported by the sentinels
+	ReplicaRead bool `json:"replica_read"`
+
+	// Connect with TLS, implied by any other TLS option below
+	TLS bool `json:"tls"`
+
+	// TLS configuration, used as the base of the CA and cert files below
+	TLSConfig *tls.Config `json:"-"`
+
+	// PEM file of the CA certificates that verify the server
+	TLSCAFile string `json:"tls_ca_file"`
+
+	// PEM files of the client certificate and key for mutual TLS. The CA,
+	// cert and key files are loaded again when they are modified
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+
+	// Server name to verify the certificate against (SNI), defaults to
+	// the host being connected to
+	TLSServerName string `json:"tls_server_name"`
+
+	// Number of connections shared by all commands in multiplexed mode,
+	// the commands of many goroutines are written to them together and
+	// their replies dispatched in order. Blocking commands, transactions,
+	// pipelines and Pub/Sub still use the pool. Leave 0 to send every
+	// command on a pooled connection of its own
+	Multiplex int `json:"multiplex"`
+
+	// Lua scripts loaded on every new connection, see also
+	// Connector.LoadScripts
+	Scripts []*Script `json:"-"`
+
+	// Hooks called for every command, pipeline and dial, see also
+	// Connector.AddHook
+	Hooks []Hook `json:"-"`
+
+	// Codec of the values of Connector.SetValue and Connector.GetValue,
+	// defaults to JsonCodec
+	Codec Codec `json:"-"`
+
+	// Values larger than this size (bytes) once marshaled by Codec are
+	// compressed with gzip, leave 0 to disable compression. Compressed
+	// values are still read back after it is changed
+	CompressThreshold int `json:"compress_threshold"`
+
+	// RESP protocol version, 2 (default) or 3. Version 3 is negotiated
+	// with HELLO on every new connection and requires Redis 6.0 or later
+	Protocol int `json:"protocol"`
+}
+
+func (cfg *Config) parse_url() error {
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		cfg.TLS = true
+	default:
+		return fmt.Errorf("url: invalid scheme %q", u.Scheme)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	portn, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("url: invalid port %q", port)
+	}
+	cfg.Host, cfg.Port = host, uint16(portn)
+
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		db, err := strconv.Atoi(path)
+		if err != nil || db < 0 {
+			return fmt.Errorf("url: invalid db %q", path)
+		}
+		cfg.DB = db
+	}
+
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			cfg.Username, cfg.Auth = u.User.Username(), pass
+		}
+	}
+
+	return nil
 }
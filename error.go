@@ -0,0 +1,88 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Errors to match the prefix of a server error reply with errors.Is, e.g.
+// errors.Is(rs.Err(), redisgo.ErrWrongType).
+var (
+	ErrGeneric     = &RedisError{Prefix: "ERR"}
+	ErrWrongType   = &RedisError{Prefix: "WRONGTYPE"}
+	ErrMoved       = &RedisError{Prefix: "MOVED"}
+	ErrAsk         = &RedisError{Prefix: "ASK"}
+	ErrTryAgain    = &RedisError{Prefix: "TRYAGAIN"}
+	ErrCrossSlot   = &RedisError{Prefix: "CROSSSLOT"}
+	ErrClusterDown = &RedisError{Prefix: "CLUSTERDOWN"}
+	ErrNoScript    = &RedisError{Prefix: "NOSCRIPT"}
+	ErrBusy        = &RedisError{Prefix: "BUSY"}
+	ErrLoading     = &RedisError{Prefix: "LOADING"}
+	ErrReadOnly    = &RedisError{Prefix: "READONLY"}
+	ErrMasterDown  = &RedisError{Prefix: "MASTERDOWN"}
+	ErrNoAuth      = &RedisError{Prefix: "NOAUTH"}
+	ErrWrongPass   = &RedisError{Prefix: "WRONGPASS"}
+	ErrNoPerm      = &RedisError{Prefix: "NOPERM"}
+	ErrOOM         = &RedisError{Prefix: "OOM"}
+	ErrExecAbort   = &RedisError{Prefix: "EXECABORT"}
+)
+
+// RedisError is the error of a failed command returned by Result.Err.
+// Prefix is set for server error replies, and Err holds the underlying
+// error of a transport failure, e.g. a net.Error or context.Canceled.
+type RedisError struct {
+	Status  uint8
+	Prefix  string
+	Message string
+	Err     error
+}
+
+// newRedisError parses a server error reply, its prefix is the first word
+// of the message by convention, e.g. "WRONGTYPE Operation against a key".
+func newRedisError(msg string) *RedisError {
+	e := &RedisError{
+		Status:  ResultError,
+		Message: msg,
+	}
+	if n := strings.IndexByte(msg, ' '); n > 0 {
+		e.Prefix = msg[:n]
+	} else {
+		e.Prefix = msg
+	}
+	return e
+}
+
+func (e *RedisError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "redis: status " + strconv.Itoa(int(e.Status))
+}
+
+func (e *RedisError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the prefix errors above, so that any reply with the same
+// prefix is reported by errors.Is.
+func (e *RedisError) Is(target error) bool {
+	t, ok := target.(*RedisError)
+	return ok && t.Message == "" && t.Prefix != "" && t.Prefix == e.Prefix
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lynkdb/redisgo"
@@ -51,7 +52,7 @@ func main() {
 	{
 		fmt.Println("SET API::String() string")
 		conn.Cmd("set", "aa", "val-aaaaaaaaaaaaaaaaaa")
-		conn.Cmd("multi_set", []string{
+		conn.Cmd("mset", []string{
 			"bb", "val-bbbbbbbbbbbbbbbbbb",
 			"cc", "val-cccccccccccccccccc",
 		})
@@ -94,18 +95,14 @@ func main() {
 
 	{
 		fmt.Println("SCAN")
-		if rs := conn.Cmd("scan", 0, "COUNT", 2); rs.OK() && len(rs.Items) == 2 {
-			print_ok(fmt.Sprintf("OK multi len: %d", len(rs.Items)))
-			if len(rs.Items[1].Items) == 2 {
-				print_ok(fmt.Sprintf("  offset %s", rs.Items[0].String()))
-				for i, v := range rs.Items[1].Items {
-					print_ok(fmt.Sprintf("  No. %d key:%s", i, v.String()))
-				}
-			} else {
-				print_ok(fmt.Sprintf("  ERR items len: %d", len(rs.Items[0].Items)))
+		n := 0
+		for key, err := range conn.Scan(context.Background(), redisgo.ScanOptions{Count: 2}) {
+			if err != nil {
+				print_err("ER " + err.Error())
+				break
 			}
-		} else {
-			print_err("ER " + rs.String())
+			print_ok(fmt.Sprintf("  No. %d key:%s", n, key))
+			n++
 		}
 	}
 
@@ -114,17 +111,12 @@ func main() {
 		conn.Cmd("zadd", "z", 3, "a")
 		conn.Cmd("zadd", "z", -2, "b")
 		conn.Cmd("zadd", "z", 5, "c")
-		if rs := conn.Cmd("zscan", "z", 0, "COUNT", 3); rs.OK() && len(rs.Items) == 2 {
-			print_ok(fmt.Sprintf("OK multi len: %d", len(rs.Items)))
-			if rs.Items[1].KvLen() == 3 {
-				rs.Items[1].KvEach(func(k, v *redisgo.Result) {
-					print_ok(fmt.Sprintf("  key:%s value:%s", k.String(), v.String()))
-				})
-			} else {
-				print_ok(fmt.Sprintf("  ERR items len: %d", rs.Items[0].KvLen()))
+		for v, err := range conn.ZScan(context.Background(), "z", redisgo.ScanOptions{Count: 3}) {
+			if err != nil {
+				print_err("ER " + err.Error())
+				break
 			}
-		} else {
-			print_err("ER " + rs.String())
+			print_ok(fmt.Sprintf("  key:%s value:%s", v.Key.String(), v.Value.String()))
 		}
 	}
 
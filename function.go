@@ -0,0 +1,174 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+var err_function_code = errors.New("function: code must start with #!<engine> name=<library>")
+
+// FunctionLibrary is a library of Redis 7 functions. Its code starts with
+// a shebang line naming the engine and the library, e.g.
+//
+//	#!lua name=mylib
+//	redis.register_function('hello', function(keys, args) return 'hi' end)
+type FunctionLibrary struct {
+	name string
+	code string
+}
+
+// Function is a function of a library, called with FCALL or FCALL_RO.
+type Function struct {
+	name string
+}
+
+func NewFunctionLibrary(code string) (*FunctionLibrary, error) {
+
+	line, _, _ := strings.Cut(code, "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return nil, err_function_code
+	}
+
+	for _, v := range strings.Fields(line)[1:] {
+		if name, ok := strings.CutPrefix(v, "name="); ok && name != "" {
+			return &FunctionLibrary{
+				name: name,
+				code: code,
+			}, nil
+		}
+	}
+
+	return nil, err_function_code
+}
+
+// NewFunctionLibraryFS reads the code of a library from a file of fsys,
+// e.g. an embed.FS:
+//
+//	//go:embed mylib.lua
+//	var libfs embed.FS
+//
+//	lib, err := redisgo.NewFunctionLibraryFS(libfs, "mylib.lua")
+func NewFunctionLibraryFS(fsys fs.FS, path string) (*FunctionLibrary, error) {
+	bs, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFunctionLibrary(string(bs))
+}
+
+func (l *FunctionLibrary) Name() string {
+	return l.name
+}
+
+func (l *FunctionLibrary) Code() string {
+	return l.code
+}
+
+// Function returns the function name of the library.
+func (l *FunctionLibrary) Function(name string) *Function {
+	return &Function{
+		name: name,
+	}
+}
+
+// Load loads the library with FUNCTION LOAD REPLACE unless FUNCTION LIST
+// reports the same code, and reports whether it was loaded. A
+// ClusterConnector loads it on every master.
+func (l *FunctionLibrary) Load(c Cmder) (bool, error) {
+	return l.LoadContext(context.Background(), c)
+}
+
+func (l *FunctionLibrary) LoadContext(ctx context.Context, c Cmder) (bool, error) {
+
+	cc, ok := c.(*ClusterConnector)
+	if !ok {
+		return l.load(ctx, c)
+	}
+
+	nodes, err := cc.masters()
+	if err != nil {
+		return false, err
+	}
+
+	loaded := false
+	for _, node := range nodes {
+		ok, err := l.load(ctx, node)
+		if err != nil {
+			return loaded, err
+		}
+		loaded = loaded || ok
+	}
+
+	return loaded, nil
+}
+
+func (l *FunctionLibrary) load(ctx context.Context, c Cmder) (bool, error) {
+
+	rs := c.CmdContext(ctx, "function", "list", "libraryname", l.name, "withcode")
+	if err := rs.Err(); err != nil {
+		return false, err
+	}
+
+	// the pattern also matches names with l.name as a prefix
+	for _, v := range rs.Items {
+		m := v.Map()
+		name, code := m["library_name"], m["library_code"]
+		if name != nil && code != nil &&
+			name.String() == l.name && code.String() == l.code {
+			return false, nil
+		}
+	}
+
+	rs = c.CmdContext(ctx, "function", "load", "replace", l.code)
+	if err := rs.Err(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Call calls the function with FCALL, keys and args are passed as the
+// keys and args of the function, a ClusterConnector routes the command by
+// the first key.
+func (f *Function) Call(c Cmder, keys []string, args ...interface{}) *Result {
+	return f.CallContext(context.Background(), c, keys, args...)
+}
+
+func (f *Function) CallContext(ctx context.Context, c Cmder, keys []string, args ...interface{}) *Result {
+	return c.CmdContext(ctx, "fcall", f.args(keys, args)...)
+}
+
+// CallRO calls a function registered with the no-writes flag with
+// FCALL_RO, which may run on replicas.
+func (f *Function) CallRO(c Cmder, keys []string, args ...interface{}) *Result {
+	return f.CallROContext(context.Background(), c, keys, args...)
+}
+
+func (f *Function) CallROContext(ctx context.Context, c Cmder, keys []string, args ...interface{}) *Result {
+	return c.CmdContext(ctx, "fcall_ro", f.args(keys, args)...)
+}
+
+func (f *Function) args(keys []string, args []interface{}) []interface{} {
+	cargs := make([]interface{}, 0, 2+len(keys)+len(args))
+	cargs = append(cargs, f.name, len(keys))
+	for _, k := range keys {
+		cargs = append(cargs, k)
+	}
+	return append(cargs, args...)
+}
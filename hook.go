@@ -0,0 +1,134 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"time"
+)
+
+// HookEvent describes a command, a command of a pipeline or a dial. The
+// fields after Args are set before the After callback is called.
+type HookEvent struct {
+	Cmd  string
+	Args []interface{}
+	Addr string // address of a dial
+
+	Duration     time.Duration
+	Status       uint8
+	BytesWritten int64
+	BytesRead    int64
+	Err          error // dial, network or transaction error
+}
+
+// Hook observes the commands, pipelines and dials of a Connector, e.g.
+// for logging, tracing or metrics. The context returned by a Before
+// callback is used for the operation and passed to the After callbacks.
+// Embed NopHook to implement only some of the callbacks.
+type Hook interface {
+	BeforeCmd(ctx context.Context, ev *HookEvent) context.Context
+	AfterCmd(ctx context.Context, ev *HookEvent)
+
+	// Pipelines and transactions, with one event per queued command
+	BeforePipeline(ctx context.Context, evs []*HookEvent) context.Context
+	AfterPipeline(ctx context.Context, evs []*HookEvent)
+
+	BeforeDial(ctx context.Context, ev *HookEvent) context.Context
+	AfterDial(ctx context.Context, ev *HookEvent)
+}
+
+// NopHook implements Hook with callbacks that do nothing.
+type NopHook struct{}
+
+func (NopHook) BeforeCmd(ctx context.Context, ev *HookEvent) context.Context {
+	return ctx
+}
+
+func (NopHook) AfterCmd(ctx context.Context, ev *HookEvent) {}
+
+func (NopHook) BeforePipeline(ctx context.Context, evs []*HookEvent) context.Context {
+	return ctx
+}
+
+func (NopHook) AfterPipeline(ctx context.Context, evs []*HookEvent) {}
+
+func (NopHook) BeforeDial(ctx context.Context, ev *HookEvent) context.Context {
+	return ctx
+}
+
+func (NopHook) AfterDial(ctx context.Context, ev *HookEvent) {}
+
+// AddHook adds a hook called for every command, pipeline and dial from
+// now on, after the hooks added before it.
+func (c *Connector) AddHook(h Hook) {
+	c.copts.add_hook(h)
+	if c.sentinel != nil {
+		c.sentinel.add_hook(h)
+	}
+}
+
+func (o *connOptions) add_hook(h Hook) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// copy on write, callers iterate over their own snapshot
+	hooks := make([]Hook, len(o.hooks), len(o.hooks)+1)
+	copy(hooks, o.hooks)
+	o.hooks = append(hooks, h)
+}
+
+func (o *connOptions) hook_list() []Hook {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.hooks
+}
+
+func hook_before_cmd(ctx context.Context, hooks []Hook, ev *HookEvent) context.Context {
+	for _, h := range hooks {
+		ctx = h.BeforeCmd(ctx, ev)
+	}
+	return ctx
+}
+
+func hook_after_cmd(ctx context.Context, hooks []Hook, ev *HookEvent) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterCmd(ctx, ev)
+	}
+}
+
+func hook_before_pipeline(ctx context.Context, hooks []Hook, evs []*HookEvent) context.Context {
+	for _, h := range hooks {
+		ctx = h.BeforePipeline(ctx, evs)
+	}
+	return ctx
+}
+
+func hook_after_pipeline(ctx context.Context, hooks []Hook, evs []*HookEvent) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterPipeline(ctx, evs)
+	}
+}
+
+func hook_before_dial(ctx context.Context, hooks []Hook, ev *HookEvent) context.Context {
+	for _, h := range hooks {
+		ctx = h.BeforeDial(ctx, ev)
+	}
+	return ctx
+}
+
+func hook_after_dial(ctx context.Context, hooks []Hook, ev *HookEvent) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterDial(ctx, ev)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"fmt"
+	"time"
+)
+
+// Key is a typed view of the keys named by a format, whose values of type
+// T are marshaled by a codec. The args of the methods fill the format:
+//
+//	users := redisgo.NewKey[User](conn, "user:%d", nil)
+//	users.Set(user, time.Hour, 42)
+//	user, ok, err := users.Get(42)
+type Key[T any] struct {
+	c      *Connector
+	format string
+	codec  Codec
+}
+
+// NewKey returns a Key of the keys named by format, codec defaults to the
+// codec of the connector if nil.
+func NewKey[T any](c *Connector, format string, codec Codec) *Key[T] {
+	if codec == nil {
+		codec = c.cfg.Codec
+	}
+	return &Key[T]{
+		c:      c,
+		format: format,
+		codec:  codec,
+	}
+}
+
+// Name returns the key named by the format and args.
+func (k *Key[T]) Name(args ...interface{}) string {
+	if len(args) == 0 {
+		return k.format
+	}
+	return fmt.Sprintf(k.format, args...)
+}
+
+// Get returns the value of the key, or the zero value and false if the key
+// does not exist.
+func (k *Key[T]) Get(args ...interface{}) (T, bool, error) {
+
+	var v T
+
+	rs := k.c.Cmd("get", k.Name(args...))
+	if rs.NotFound() {
+		return v, false, nil
+	}
+	if err := rs.Err(); err != nil {
+		return v, false, err
+	}
+
+	if err := k.c.value_decode(k.codec, rs.data, &v); err != nil {
+		return v, false, err
+	}
+
+	return v, true, nil
+}
+
+// Set stores v in the key, with an expiration of ttl if it is greater
+// than 0.
+func (k *Key[T]) Set(v T, ttl time.Duration, args ...interface{}) error {
+	_, err := k.set(v, ttl, false, args)
+	return err
+}
+
+// SetNX stores v in the key only if it does not exist, and reports
+// whether it was stored.
+func (k *Key[T]) SetNX(v T, ttl time.Duration, args ...interface{}) (bool, error) {
+	return k.set(v, ttl, true, args)
+}
+
+func (k *Key[T]) set(v T, ttl time.Duration, nx bool, args []interface{}) (bool, error) {
+
+	bs, err := k.c.value_encode(k.codec, v)
+	if err != nil {
+		return false, err
+	}
+
+	cmd := []interface{}{k.Name(args...), bs}
+	if ttl > 0 {
+		cmd = append(cmd, "px", ttl)
+	}
+	if nx {
+		cmd = append(cmd, "nx")
+	}
+
+	rs := k.c.Cmd("set", cmd...)
+	if rs.NotFound() {
+		// not set by NX
+		return false, nil
+	}
+
+	return rs.OK(), rs.Err()
+}
+
+// Delete removes the key and reports whether it existed.
+func (k *Key[T]) Delete(args ...interface{}) (bool, error) {
+	rs := k.c.Cmd("del", k.Name(args...))
+	if err := rs.Err(); err != nil {
+		return false, err
+	}
+	return rs.Int64() > 0, nil
+}
+
+// TTL returns the time to live of the key, 0 if it has no expiration, and
+// false if the key does not exist.
+func (k *Key[T]) TTL(args ...interface{}) (time.Duration, bool, error) {
+
+	rs := k.c.Cmd("pttl", k.Name(args...))
+	if err := rs.Err(); err != nil {
+		return 0, false, err
+	}
+
+	switch n := rs.Int64(); {
+	case n == -2:
+		return 0, false, nil
+	case n < 0:
+		return 0, true, nil
+	default:
+		return time.Duration(n) * time.Millisecond, true, nil
+	}
+}
+
+// Update reads the key, calls fn with its value, or the zero value and
+// false if it does not exist, and stores the value returned by fn keeping
+// the expiration of the key. It runs in a transaction that WATCHes the key
+// and is retried if the key is changed meanwhile, up to ErrTxAborted. An
+// error is returned if the connection is lost after EXEC was sent, as the
+// value may or may not have been stored.
+func (k *Key[T]) Update(fn func(v T, ok bool) (T, error), args ...interface{}) (T, error) {
+
+	var (
+		name = k.Name(args...)
+		nv   T
+	)
+
+	ls, err := k.c.Transaction(func(tx *Tx) error {
+
+		var v T
+
+		rs := tx.Cmd("get", name)
+		if err := rs.Err(); err != nil {
+			return err
+		}
+		if rs.OK() {
+			if err := k.c.value_decode(k.codec, rs.data, &v); err != nil {
+				return err
+			}
+		}
+
+		v, err := fn(v, rs.OK())
+		if err != nil {
+			return err
+		}
+
+		bs, err := k.c.value_encode(k.codec, v)
+		if err != nil {
+			return err
+		}
+
+		tx.Queue("set", name, bs, "keepttl")
+		nv = v
+
+		return nil
+	}, name)
+
+	if err == nil && len(ls) == 1 {
+		err = ls[0].Err()
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return nv, nil
+}
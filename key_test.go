@@ -0,0 +1,72 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyUpdateConnLost(t *testing.T) {
+
+	for _, drop := range []string{"get", "multi"} {
+
+		var (
+			mu    sync.Mutex
+			execs int
+		)
+
+		// the first connection is closed when drop is received, a write
+		// that reached the server after it would show up as an EXEC
+		s := newTestServer(t, func(conn int, args []string) string {
+			if conn == 1 && args[0] == drop {
+				return ""
+			}
+			switch args[0] {
+			case "get":
+				return "$2\r\n\x001\r\n"
+			case "multi", "watch", "unwatch":
+				return "+OK\r\n"
+			case "set":
+				return "+QUEUED\r\n"
+			case "exec":
+				mu.Lock()
+				execs++
+				mu.Unlock()
+				return "*1\r\n+OK\r\n"
+			}
+			return "+PONG\r\n"
+		})
+
+		k := NewKey[int](s.connector(t), "counter:%d", nil)
+
+		_, err := k.Update(func(v int, ok bool) (int, error) {
+			return v + 1, nil
+		}, 1)
+		if err == nil {
+			t.Fatalf("drop on %s: Update succeeded", drop)
+		}
+
+		mu.Lock()
+		n := execs
+		mu.Unlock()
+		if n != 0 {
+			t.Fatalf("drop on %s: %d EXEC on a new connection", drop, n)
+		}
+		if n := s.conns.Load(); n != 1 {
+			t.Fatalf("drop on %s: %d connections", drop, n)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var err_mux_reset = errors.New("connection reset")
+
+// Commands that block, hold the state of a connection or wait for pushes
+// are sent on a pooled connection in multiplexed mode.
+var mux_cmd_dedicated = map[string]bool{
+	"blpop":        true,
+	"brpop":        true,
+	"brpoplpush":   true,
+	"blmove":       true,
+	"blmpop":       true,
+	"bzpopmin":     true,
+	"bzpopmax":     true,
+	"bzmpop":       true,
+	"xread":        true,
+	"xreadgroup":   true,
+	"wait":         true,
+	"waitaof":      true,
+	"multi":        true,
+	"exec":         true,
+	"discard":      true,
+	"watch":        true,
+	"unwatch":      true,
+	"subscribe":    true,
+	"psubscribe":   true,
+	"ssubscribe":   true,
+	"unsubscribe":  true,
+	"punsubscribe": true,
+	"sunsubscribe": true,
+	"monitor":      true,
+	"select":       true,
+	"auth":         true,
+	"hello":        true,
+	"client":       true,
+	"reset":        true,
+	"quit":         true,
+	"readonly":     true,
+	"readwrite":    true,
+	"asking":       true,
+}
+
+// mux shares a few connections between all commands, see Config.Multiplex.
+type mux struct {
+	conns []*muxConn
+	next  atomic.Uint32
+}
+
+// muxConn is one shared connection. Commands are queued by the callers,
+// written with a single flush by the writer goroutine, and their replies
+// are dispatched in FIFO order by the reader goroutine of the session.
+type muxConn struct {
+	mu     sync.Mutex
+	copts  *connOptions
+	queue  []*muxReq
+	sess   *muxSession
+	wake   chan struct{}
+	stop   chan struct{}
+	closed bool
+}
+
+// muxSession is one socket of a muxConn, it is replaced after an error.
+type muxSession struct {
+	mu       sync.Mutex
+	cli      *client
+	sock     net.Conn
+	timeout  time.Duration
+	inflight []*muxReq
+	dead     bool
+}
+
+type muxReq struct {
+	buf  []byte
+	rs   *Result
+	nr   int64
+	done chan struct{}
+}
+
+func newMux(copts *connOptions, num int) *mux {
+	m := &mux{}
+	for i := 0; i < num; i++ {
+		mc := &muxConn{
+			copts: copts,
+			wake:  make(chan struct{}, 1),
+			stop:  make(chan struct{}),
+		}
+		go mc.run()
+		m.conns = append(m.conns, mc)
+	}
+	return m
+}
+
+func (m *mux) cmd(ctx context.Context, ev *HookEvent, cmd string, args []interface{}) *Result {
+
+	buf, err := send_buf_cmd(cmd, args)
+	if err != nil {
+		return newResult(ResultBadArgument, err)
+	}
+
+	r := &muxReq{
+		buf:  buf,
+		done: make(chan struct{}),
+	}
+
+	mc := m.conns[int(m.next.Add(1))%len(m.conns)]
+	if !mc.push(r) {
+		return newResult(ResultNetworkException, err_pool_closed)
+	}
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		// the reply is discarded when it is read
+		return newResult(ResultCanceled, ctx.Err())
+	}
+
+	if ev != nil {
+		ev.BytesWritten += int64(len(buf))
+		ev.BytesRead += r.nr
+	}
+
+	return r.rs
+}
+
+func (m *mux) close() {
+	for _, mc := range m.conns {
+		mc.close()
+	}
+}
+
+func (mc *muxConn) push(r *muxReq) bool {
+
+	mc.mu.Lock()
+	if mc.closed {
+		mc.mu.Unlock()
+		return false
+	}
+	mc.queue = append(mc.queue, r)
+	mc.mu.Unlock()
+
+	select {
+	case mc.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+func (mc *muxConn) run() {
+
+	for {
+
+		select {
+		case <-mc.wake:
+		case <-mc.stop:
+			return
+		}
+
+		mc.mu.Lock()
+		reqs := mc.queue
+		mc.queue = nil
+		mc.mu.Unlock()
+
+		if len(reqs) > 0 {
+			mc.flush(reqs)
+		}
+	}
+}
+
+// flush writes reqs on the current session, a new one is dialed if there
+// is none, it has failed or the address of the server has changed.
+func (mc *muxConn) flush(reqs []*muxReq) {
+
+	var buf bytes.Buffer
+	for _, r := range reqs {
+		buf.Write(r.buf)
+	}
+
+	for try := 1; ; try++ {
+
+		sess, rs := mc.session()
+		if rs != nil {
+			for _, r := range reqs {
+				r.rs = newResult(rs.Status, rs.err)
+				close(r.done)
+			}
+			return
+		}
+
+		sess.mu.Lock()
+		if sess.dead && try < 3 {
+			// failed meanwhile, nothing was written yet
+			sess.mu.Unlock()
+			continue
+		}
+		if sess.dead {
+			sess.mu.Unlock()
+			mux_fail(reqs, err_mux_reset)
+			return
+		}
+		sess.inflight = append(sess.inflight, reqs...)
+		sess.sock.SetReadDeadline(time.Now().Add(sess.timeout))
+		sess.mu.Unlock()
+
+		sess.sock.SetWriteDeadline(time.Now().Add(sess.timeout))
+		if _, err := sess.sock.Write(buf.Bytes()); err != nil {
+			// fails the requests in flight, including reqs
+			sess.fail(err)
+		}
+		return
+	}
+}
+
+func (mc *muxConn) session() (*muxSession, *Result) {
+
+	mc.mu.Lock()
+	sess := mc.sess
+	mc.mu.Unlock()
+
+	if sess != nil {
+		sess.mu.Lock()
+		dead := sess.dead
+		sess.mu.Unlock()
+		if !dead && sess.cli.gen == mc.copts.generation() {
+			return sess, nil
+		}
+		sess.fail(err_mux_reset)
+	}
+
+	cli := &client{
+		copts: mc.copts,
+	}
+	if rs := cli.reconnect(context.Background()); rs != nil {
+		return nil, rs
+	}
+
+	sess = &muxSession{
+		cli:     cli,
+		sock:    cli.sock,
+		timeout: mc.copts.timeout,
+	}
+	sess.sock.SetDeadline(time.Time{})
+
+	mc.mu.Lock()
+	if mc.closed {
+		mc.mu.Unlock()
+		sess.sock.Close()
+		return nil, newResult(ResultNetworkException, err_pool_closed)
+	}
+	mc.sess = sess
+	mc.mu.Unlock()
+
+	go sess.read()
+
+	return sess, nil
+}
+
+func (mc *muxConn) close() {
+
+	mc.mu.Lock()
+	if mc.closed {
+		mc.mu.Unlock()
+		return
+	}
+	mc.closed = true
+	reqs, sess := mc.queue, mc.sess
+	mc.queue = nil
+	mc.mu.Unlock()
+
+	close(mc.stop)
+	mux_fail(reqs, err_pool_closed)
+	if sess != nil {
+		sess.fail(err_pool_closed)
+	}
+}
+
+func (s *muxSession) read() {
+
+	for {
+
+		nr := s.cli.nread()
+		rs, err := s.cli.cmd_parse()
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		s.mu.Lock()
+		if len(s.inflight) == 0 {
+			s.mu.Unlock()
+			s.fail(err_parse)
+			return
+		}
+		r := s.inflight[0]
+		s.inflight = s.inflight[1:]
+		if len(s.inflight) == 0 {
+			// idle, waits for the next write
+			s.sock.SetReadDeadline(time.Time{})
+		} else {
+			s.sock.SetReadDeadline(time.Now().Add(s.timeout))
+		}
+		s.mu.Unlock()
+
+		r.rs, r.nr = rs, s.cli.nread()-nr
+		close(r.done)
+	}
+}
+
+// fail closes the socket and fails the requests in flight with err.
+func (s *muxSession) fail(err error) {
+
+	s.mu.Lock()
+	if s.dead {
+		s.mu.Unlock()
+		return
+	}
+	s.dead = true
+	reqs := s.inflight
+	s.inflight = nil
+	s.mu.Unlock()
+
+	s.sock.Close()
+	mux_fail(reqs, err)
+}
+
+func mux_fail(reqs []*muxReq, err error) {
+	for _, r := range reqs {
+		if err == err_pool_closed {
+			r.rs = newResult(ResultNetworkException, err)
+		} else {
+			r.rs = net_result(err)
+		}
+		close(r.done)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// Pipeline queues commands locally and sends them to the server with a
+// single write, then reads all of the replies back in order.
+type Pipeline struct {
+	c   *Connector
+	buf bytes.Buffer
+	rss []*Result
+	evs []*HookEvent
+	num int
+}
+
+func (c *Connector) Pipeline() *Pipeline {
+	return &Pipeline{
+		c: c,
+	}
+}
+
+// Cmd queues a command. Commands with bad arguments are not sent, their
+// slot in the Exec results is set to a ResultBadArgument result.
+func (p *Pipeline) Cmd(cmd string, args ...interface{}) *Pipeline {
+
+	p.evs = append(p.evs, &HookEvent{
+		Cmd:  cmd,
+		Args: args,
+	})
+
+	buf, err := send_buf_cmd(cmd, args)
+	if err != nil {
+		p.rss = append(p.rss, newResult(ResultBadArgument, err))
+		return p
+	}
+
+	p.buf.Write(buf)
+	p.rss = append(p.rss, nil)
+	p.evs[len(p.evs)-1].BytesWritten = int64(len(buf))
+	p.num++
+
+	return p
+}
+
+func (p *Pipeline) Len() int {
+	return len(p.rss)
+}
+
+// Exec flushes the queued commands and returns one Result per command in
+// the order they were queued. Server side errors are reported per command
+// by Result.Status, the returned error is only set on network failure.
+func (p *Pipeline) Exec() ([]*Result, error) {
+	return p.ExecContext(context.Background())
+}
+
+func (p *Pipeline) ExecContext(ctx context.Context) ([]*Result, error) {
+
+	defer p.reset()
+
+	hooks := p.c.copts.hook_list()
+	if len(hooks) == 0 {
+		return p.exec(ctx, nil)
+	}
+
+	ctx = hook_before_pipeline(ctx, hooks, p.evs)
+
+	tn := time.Now()
+	sizes := make([]int64, p.num)
+	rss, err := p.exec(ctx, sizes)
+
+	for i, j := 0, 0; i < len(p.evs); i++ {
+		ev := p.evs[i]
+		ev.Duration, ev.Err = time.Since(tn), err
+		switch {
+		case err != nil:
+			ev.Status = ResultNetworkException
+		case p.rss[i] != nil:
+			ev.Status = p.rss[i].Status
+		default:
+			ev.Status, ev.BytesRead, j = rss[i].Status, sizes[j], j+1
+		}
+	}
+
+	hook_after_pipeline(ctx, hooks, p.evs)
+
+	return rss, err
+}
+
+func (p *Pipeline) exec(ctx context.Context, sizes []int64) ([]*Result, error) {
+
+	if p.num == 0 {
+		return p.rss, nil
+	}
+
+	cli, err := p.c.pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := cli.Pipeline(ctx, p.buf.Bytes(), p.num, sizes)
+	p.c.push(cli)
+	if err != nil {
+		return nil, err
+	}
+
+	rss := make([]*Result, len(p.rss))
+	for i, j := 0, 0; i < len(rss); i++ {
+		if rss[i] = p.rss[i]; rss[i] == nil {
+			rss[i], j = ls[j], j+1
+		}
+	}
+
+	return rss, nil
+}
+
+func (p *Pipeline) reset() {
+	p.buf.Reset()
+	p.rss = nil
+	p.evs = nil
+	p.num = 0
+}
@@ -0,0 +1,282 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	err_pool_timeout = errors.New("pool timeout")
+	err_pool_closed  = errors.New("pool closed")
+
+	pool_reap_interval = time.Second
+)
+
+type poolOptions struct {
+	max_open     int
+	min_idle     int
+	wait_timeout time.Duration
+	idle_timeout time.Duration
+	lifetime     time.Duration
+	check        time.Duration
+}
+
+// pool holds up to max_open connections. Idle connections are reused in
+// LIFO order, a connection is only dialed when none is idle, and callers
+// wait for a free slot for up to wait_timeout.
+type pool struct {
+	mu     sync.Mutex
+	copts  *connOptions
+	popts  poolOptions
+	slots  chan struct{}
+	idle   []*client
+	open   int
+	closed bool
+	stop   chan struct{}
+	stats  poolStats
+}
+
+func newPool(copts *connOptions, popts poolOptions) *pool {
+
+	p := &pool{
+		copts: copts,
+		popts: popts,
+		slots: make(chan struct{}, popts.max_open),
+		stop:  make(chan struct{}),
+	}
+
+	if popts.min_idle > 0 || popts.idle_timeout > 0 || popts.lifetime > 0 {
+		go p.reap()
+	}
+
+	return p
+}
+
+// get takes a free slot and returns an idle connection, or a new client
+// that is dialed on its first command.
+func (p *pool) get(ctx context.Context) (*client, error) {
+
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.slots
+			return nil, err_pool_closed
+		}
+
+		n := len(p.idle)
+		if n == 0 {
+			p.open++
+			p.mu.Unlock()
+			p.stats.misses.Add(1)
+			return &client{copts: p.copts, stats: &p.stats}, nil
+		}
+
+		cli := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		p.stats.hits.Add(1)
+
+		if p.expired(cli, time.Now()) || !p.healthy(ctx, cli) {
+			p.discard(cli)
+			continue
+		}
+
+		return cli, nil
+	}
+}
+
+func (p *pool) wait(ctx context.Context) error {
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	p.stats.waits.Add(1)
+
+	tn := time.Now()
+	defer func() {
+		p.stats.wait_ns.Add(uint64(time.Since(tn)))
+	}()
+
+	var tc <-chan time.Time
+	if p.popts.wait_timeout > 0 {
+		t := time.NewTimer(p.popts.wait_timeout)
+		defer t.Stop()
+		tc = t.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-tc:
+		p.stats.timeouts.Add(1)
+		return err_pool_timeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// put returns a connection taken by get and frees its slot.
+func (p *pool) put(cli *client) {
+
+	defer func() {
+		<-p.slots
+	}()
+
+	tn := time.Now()
+
+	p.mu.Lock()
+	if p.closed || cli.sock == nil || p.expired(cli, tn) {
+		p.open--
+		p.mu.Unlock()
+		cli.Close()
+		return
+	}
+	cli.atime = tn
+	p.idle = append(p.idle, cli)
+	p.mu.Unlock()
+}
+
+// discard closes a connection that was taken out of the idle list.
+func (p *pool) discard(cli *client) {
+	cli.Close()
+	p.mu.Lock()
+	p.open--
+	p.mu.Unlock()
+}
+
+func (p *pool) expired(cli *client, tn time.Time) bool {
+	return p.popts.lifetime > 0 && !cli.ctime.IsZero() &&
+		tn.Sub(cli.ctime) >= p.popts.lifetime
+}
+
+// healthy pings a connection that has been idle for longer than the
+// health check interval.
+func (p *pool) healthy(ctx context.Context, cli *client) bool {
+	if p.popts.check <= 0 || cli.sock == nil ||
+		time.Since(cli.atime) < p.popts.check {
+		return true
+	}
+	return cli.CmdContext(ctx, "ping").OK()
+}
+
+// fill dials new connections until num connections are idle, without
+// going over max_open.
+func (p *pool) fill(num int) error {
+
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= num ||
+			p.open >= p.popts.max_open {
+			p.mu.Unlock()
+			return nil
+		}
+		p.open++
+		p.mu.Unlock()
+
+		cli, err := newClient(p.copts)
+		p.stats.misses.Add(1)
+
+		p.mu.Lock()
+		if err != nil || p.closed {
+			p.open--
+			p.mu.Unlock()
+			if cli != nil {
+				cli.Close()
+			}
+			return err
+		}
+		cli.atime = time.Now()
+		cli.stats = &p.stats
+		p.idle = append(p.idle, cli)
+		p.mu.Unlock()
+	}
+}
+
+// reap closes idle connections past their idle timeout or lifetime, idle
+// connections are only reaped by idle timeout above min_idle.
+func (p *pool) reap() {
+
+	tr := time.NewTicker(pool_reap_interval)
+	defer tr.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-tr.C:
+		}
+
+		var (
+			tn     = time.Now()
+			closes []*client
+		)
+
+		p.mu.Lock()
+		idle := p.idle[:0]
+		for i, cli := range p.idle {
+			if (p.popts.lifetime > 0 && tn.Sub(cli.ctime) >= p.popts.lifetime) ||
+				(p.popts.idle_timeout > 0 && tn.Sub(cli.atime) >= p.popts.idle_timeout &&
+					len(p.idle)-i+len(idle) > p.popts.min_idle) {
+				closes = append(closes, cli)
+				p.open--
+			} else {
+				idle = append(idle, cli)
+			}
+		}
+		p.idle = idle
+		p.mu.Unlock()
+
+		for _, cli := range closes {
+			cli.Close()
+		}
+
+		p.fill(p.popts.min_idle)
+	}
+}
+
+// close closes the idle connections, connections in use are closed when
+// they are returned with put.
+func (p *pool) close() {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.mu.Unlock()
+
+	close(p.stop)
+
+	for _, cli := range idle {
+		cli.Close()
+	}
+}
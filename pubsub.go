@@ -0,0 +1,328 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	err_sub_closed = errors.New("subscriber closed")
+
+	sub_msg_size = 128
+)
+
+// Message is a push reply received by a Subscriber. Kind is one of
+// subscribe, unsubscribe, psubscribe, punsubscribe, message and pmessage,
+// or error with Err set when a command is refused, e.g. NOPERM on
+// SUBSCRIBE.
+type Message struct {
+	Kind    string
+	Channel string
+	Pattern string
+	Payload ResultBytes
+	Count   int
+	Err     error
+}
+
+// Subscriber owns a dedicated connection in Pub/Sub mode. Active
+// subscriptions are re-issued after the connection is re-established.
+type Subscriber struct {
+	mu       sync.Mutex
+	copts    *connOptions
+	cli      *client
+	channels map[string]bool
+	patterns map[string]bool
+	msgs     chan *Message
+	done     chan struct{}
+	closed   bool
+	tries    int // dials since the last message, only used by run
+}
+
+func (c *Connector) Subscriber() (*Subscriber, error) {
+
+	cli, err := newClient(c.copts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscriber{
+		copts:    c.copts,
+		cli:      cli,
+		channels: map[string]bool{},
+		patterns: map[string]bool{},
+		msgs:     make(chan *Message, sub_msg_size),
+		done:     make(chan struct{}),
+	}
+
+	cli.sock.SetReadDeadline(time.Time{})
+	go s.run(cli)
+
+	return s, nil
+}
+
+// Messages returns the channel of received messages, it is closed after
+// Subscriber.Close.
+func (s *Subscriber) Messages() <-chan *Message {
+	return s.msgs
+}
+
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.send("subscribe", s.channels, true, channels)
+}
+
+func (s *Subscriber) Unsubscribe(channels ...string) error {
+	return s.send("unsubscribe", s.channels, false, channels)
+}
+
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.send("psubscribe", s.patterns, true, patterns)
+}
+
+func (s *Subscriber) PUnsubscribe(patterns ...string) error {
+	return s.send("punsubscribe", s.patterns, false, patterns)
+}
+
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.cli != nil {
+		s.cli.Close()
+	}
+	return nil
+}
+
+func (s *Subscriber) send(cmd string, set map[string]bool, add bool, names []string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return err_sub_closed
+	}
+
+	if add {
+		for _, name := range names {
+			set[name] = true
+		}
+	} else if len(names) == 0 {
+		for name := range set {
+			delete(set, name)
+		}
+	} else {
+		for _, name := range names {
+			delete(set, name)
+		}
+	}
+
+	if s.cli == nil || s.cli.sock == nil {
+		// reconnecting, the subscriptions are re-issued by run
+		return nil
+	}
+
+	return s.cli.write(cmd, names)
+}
+
+func (s *Subscriber) run(cli *client) {
+
+	defer close(s.msgs)
+
+	for {
+		msg, err := cli.message()
+		if err == nil {
+			// a server refusing the connection right after accepting it
+			// is not retried without a backoff
+			if msg == nil || msg.Kind != "error" {
+				s.tries = 0
+			}
+			if msg != nil {
+				select {
+				case s.msgs <- msg:
+				case <-s.done:
+					return
+				}
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		cli.Close()
+		s.cli = nil
+		s.mu.Unlock()
+
+		if cli = s.reconnect(); cli == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds, waiting longer before every attempt
+// until a message is read on the new connection.
+func (s *Subscriber) reconnect() *client {
+
+	for {
+
+		if s.tries > 0 {
+			wait := time.Duration(s.tries) * time.Second
+			if wait > s.copts.timeout {
+				wait = s.copts.timeout
+			}
+			select {
+			case <-time.After(wait):
+			case <-s.done:
+				return nil
+			}
+		}
+
+		s.tries++
+
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+
+		cli, err := newClient(s.copts)
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			cli.Close()
+			return nil
+		}
+		err = cli.resubscribe(s.channels, s.patterns)
+		if err == nil {
+			cli.sock.SetReadDeadline(time.Time{})
+			s.cli = cli
+		}
+		s.mu.Unlock()
+
+		if err == nil {
+			return cli
+		}
+		cli.Close()
+	}
+}
+
+func (c *client) resubscribe(channels, patterns map[string]bool) error {
+
+	for cmd, set := range map[string]map[string]bool{
+		"subscribe":  channels,
+		"psubscribe": patterns,
+	} {
+		if len(set) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		if err := c.write(cmd, names); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *client) write(cmd string, names []string) error {
+
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+
+	buf, err := send_buf_cmd(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	c.sock.SetWriteDeadline(time.Now().Add(c.copts.timeout))
+	_, err = c.sock.Write(buf)
+
+	return err
+}
+
+// message blocks until the next push reply is read, replies other than
+// Pub/Sub messages (e.g. PONG) are skipped with a nil message.
+func (c *client) message() (*Message, error) {
+
+	bs, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) < 4 {
+		return nil, err_parse
+	}
+
+	// Arrays in RESP2, Pushes in RESP3, or the error reply of a command
+	switch bs[0] {
+	case '*', '>', '-', '!':
+	default:
+		return nil, err_parse
+	}
+
+	rs := &Result{}
+	if err := cmd_parse_value(rs, bs, c.reader); err != nil {
+		return nil, err
+	}
+
+	if rs.Status == ResultError {
+		return &Message{
+			Kind: "error",
+			Err:  rs.Err(),
+		}, nil
+	}
+
+	items, size := rs.Items, len(rs.Items)
+	if size < 1 {
+		return nil, err_parse
+	}
+
+	msg := &Message{
+		Kind: items[0].String(),
+	}
+
+	switch {
+
+	case msg.Kind == "message" && size == 3:
+		msg.Channel, msg.Payload = items[1].String(), items[2].Bytes()
+
+	case msg.Kind == "pmessage" && size == 4:
+		msg.Pattern, msg.Channel, msg.Payload = items[1].String(),
+			items[2].String(), items[3].Bytes()
+
+	case size == 3 && (msg.Kind == "subscribe" || msg.Kind == "unsubscribe"):
+		msg.Channel, msg.Count = items[1].String(), items[2].Int()
+
+	case size == 3 && (msg.Kind == "psubscribe" || msg.Kind == "punsubscribe"):
+		msg.Pattern, msg.Count = items[1].String(), items[2].Int()
+
+	default:
+		return nil, nil
+	}
+
+	return msg, nil
+}
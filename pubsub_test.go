@@ -0,0 +1,85 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriberErrorReply(t *testing.T) {
+
+	s := newTestServer(t, func(conn int, args []string) string {
+		if args[0] == "subscribe" {
+			return "-NOPERM User has no permissions to access the 'news' channel\r\n"
+		}
+		return "+PONG\r\n"
+	})
+
+	sub, err := s.connector(t).Subscriber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := sub.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-sub.Messages():
+		var rerr *RedisError
+		if msg.Kind != "error" || !errors.As(msg.Err, &rerr) || rerr.Prefix != "NOPERM" {
+			t.Fatalf("message %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no error message")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := s.conns.Load(); n != 2 {
+		t.Fatalf("%d connections, want the pool one and the subscriber", n)
+	}
+}
+
+func TestSubscriberReconnectBackoff(t *testing.T) {
+
+	// accepts every connection, then resets it on SUBSCRIBE
+	s := newTestServer(t, func(conn int, args []string) string {
+		if args[0] == "subscribe" {
+			return ""
+		}
+		return "+PONG\r\n"
+	})
+
+	sub, err := s.connector(t).Subscriber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := sub.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+
+	// the pool and the subscriber, then one dial right away and one
+	// after a wait of 1s
+	if n := s.conns.Load(); n > 4 {
+		t.Fatalf("%d connections in 1.5s", n)
+	}
+}
@@ -15,43 +15,120 @@
 package redisgo // import "github.com/lynkdb/redisgo"
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Connector struct {
-	clients chan *client
-	cfg     Config
-	copts   *connOptions
+	pool     *pool
+	cfg      Config
+	copts    *connOptions
+	sentinel *sentinel
+	mux      *mux
+	async    asyncQueue
 }
 
 type connOptions struct {
+	mu      sync.RWMutex
 	net     string
 	addr    string
+	gen     uint64
 	timeout time.Duration
+	user    string
 	auth    string
+	creds   func() (string, string, error)
+	db      int
+	init    func(conn *Conn) error
+	proto   int
+	tls     *tlsLoader
+	hooks   []Hook
+	scripts []*Script
+}
+
+func (o *connOptions) address() (string, string, uint64) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.net, o.addr, o.gen
+}
+
+func (o *connOptions) generation() uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.gen
+}
+
+// credentials returns the username and password to authenticate new
+// connections with, from Config.Credentials if set.
+func (o *connOptions) credentials() (string, string, error) {
+	if o.creds != nil {
+		return o.creds()
+	}
+	return o.user, o.auth, nil
+}
+
+// set_address moves new connections to addr, connections dialed to the
+// previous address are closed when they are next taken from the pool.
+func (o *connOptions) set_address(addr string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.addr != addr {
+		o.addr = addr
+		o.gen++
+	}
 }
 
 func NewConnector(cfg Config) (*Connector, error) {
 
-	if cfg.MaxConn < 1 {
-		cfg.MaxConn = 1
-	} else {
-		maxconn := runtime.NumCPU()
-		if maxconn > 10 {
-			maxconn = 10
-		}
-		if cfg.MaxConn > maxconn {
-			cfg.MaxConn = maxconn
+	if cfg.URL != "" {
+		if err := cfg.parse_url(); err != nil {
+			return nil, err
 		}
+		// parsed once, copies for cluster nodes and replicas keep their
+		// own Host and Port
+		cfg.URL = ""
+	}
+
+	if cfg.MaxOpen < 1 {
+		cfg.MaxOpen = cfg.MaxConn
+	}
+	if cfg.MaxOpen < 1 {
+		cfg.MaxOpen = 1
+	}
+	cfg.MaxConn = cfg.MaxOpen
+
+	if cfg.MinIdle > cfg.MaxOpen {
+		cfg.MinIdle = cfg.MaxOpen
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = JsonCodec
 	}
 
 	copts := &connOptions{
 		timeout: time.Duration(cfg.Timeout) * time.Second,
+		user:    cfg.Username,
 		auth:    cfg.Auth,
+		creds:   cfg.Credentials,
+		db:      cfg.DB,
+		init:    cfg.OnConnect,
+		hooks:   append([]Hook{}, cfg.Hooks...),
+		scripts: append([]*Script{}, cfg.Scripts...),
+		proto:   2,
+	}
+
+	if cfg.Protocol == 3 {
+		copts.proto = 3
+	}
+
+	tl, err := newTlsLoader(cfg)
+	if err != nil {
+		return nil, err
 	}
+	copts.tls = tl
 
 	if copts.timeout < (1 * time.Second) {
 		copts.timeout = 1 * time.Second
@@ -59,7 +136,16 @@ func NewConnector(cfg Config) (*Connector, error) {
 		copts.timeout = 600 * time.Second
 	}
 
-	if len(cfg.Socket) > 2 {
+	var sen *sentinel
+
+	if len(cfg.Sentinels) > 0 {
+		sen = newSentinel(cfg, copts)
+		addr, err := sen.master()
+		if err != nil {
+			return nil, err
+		}
+		copts.net, copts.addr = "tcp", addr
+	} else if len(cfg.Socket) > 2 {
 		if _, err := net.ResolveUnixAddr("unix", cfg.Socket); err == nil {
 			copts.net, copts.addr = "unix", cfg.Socket
 		}
@@ -73,42 +159,133 @@ func NewConnector(cfg Config) (*Connector, error) {
 		copts.net = "tcp"
 	}
 
+	popts := poolOptions{
+		max_open:     cfg.MaxOpen,
+		min_idle:     cfg.MinIdle,
+		wait_timeout: time.Duration(cfg.PoolTimeout) * time.Second,
+		idle_timeout: time.Duration(cfg.IdleTimeout) * time.Second,
+		lifetime:     time.Duration(cfg.MaxConnLifetime) * time.Second,
+		check:        time.Duration(cfg.HealthCheckInterval) * time.Second,
+	}
+
 	c := &Connector{
-		clients: make(chan *client, cfg.MaxConn),
-		cfg:     cfg,
-		copts:   copts,
+		pool:     newPool(copts, popts),
+		cfg:      cfg,
+		copts:    copts,
+		sentinel: sen,
 	}
 
-	for i := 0; i < cfg.MaxConn; i++ {
-		cli, err := newClient(c.copts)
-		if err != nil {
-			return c, err
-		}
-		c.clients <- cli
+	// at least one connection to check the server is reachable
+	if err := c.pool.fill(max(cfg.MinIdle, 1)); err != nil {
+		c.pool.close()
+		return nil, err
+	}
+
+	if cfg.Multiplex > 0 {
+		c.mux = newMux(copts, cfg.Multiplex)
+	}
+
+	if sen != nil {
+		sen.start()
 	}
 
 	return c, nil
 }
 
+// Cmd runs a command on a connection of the pool. Besides strings, []byte,
+// numbers and bools, args can be slices and maps, written as one argument
+// per element, and the types listed by RegisterArgEncoder.
+//
+// A time.Duration is sent in milliseconds, as PX, PEXPIRE and PSETEX
+// expect. EX, EXPIRE, SETEX and the timeout of BLPOP take seconds, pass
+// them an integer, or the value would be 1000 times too large.
 func (c *Connector) Cmd(cmd string, args ...interface{}) *Result {
+	return c.CmdContext(context.Background(), cmd, args...)
+}
+
+// CmdContext is like Cmd, but stops waiting for a pooled connection or for
+// the reply once ctx is done, and returns a ResultCanceled result.
+func (c *Connector) CmdContext(ctx context.Context, cmd string, args ...interface{}) *Result {
+
+	hooks := c.copts.hook_list()
+	if len(hooks) == 0 {
+		return c.cmd(ctx, nil, cmd, args)
+	}
+
+	ev := &HookEvent{
+		Cmd:  cmd,
+		Args: args,
+	}
+	ctx = hook_before_cmd(ctx, hooks, ev)
+
+	tn := time.Now()
+	rs := c.cmd(ctx, ev, cmd, args)
+	ev.Duration, ev.Status = time.Since(tn), rs.Status
+
+	hook_after_cmd(ctx, hooks, ev)
+
+	return rs
+}
+
+func (c *Connector) cmd(ctx context.Context, ev *HookEvent, cmd string, args []interface{}) *Result {
+
+	if c.sentinel != nil && c.cfg.ReplicaRead &&
+		sentinel_cmd_readonly[strings.ToLower(cmd)] {
+		if rc := c.sentinel.replica(); rc != nil {
+			// falls back to the master if the replica is unreachable
+			if rs := rc.cmd(ctx, ev, cmd, args); rs.Status != ResultNetworkException {
+				return rs
+			}
+		}
+	}
+
+	if c.mux != nil && !mux_cmd_dedicated[strings.ToLower(cmd)] {
+		return c.mux.cmd(ctx, ev, cmd, args)
+	}
+
+	cli, err := c.pull(ctx)
+	if err != nil {
+		return pool_result(err)
+	}
 
-	cli, _ := c.pull()
+	if ev != nil {
+		nw, nr := cli.nw, cli.nread()
+		defer func() {
+			ev.BytesWritten += cli.nw - nw
+			ev.BytesRead += cli.nread() - nr
+		}()
+	}
 
 	var rs *Result
 
-	for try := 1; try <= 3; try++ {
+	for try := 1; ; try++ {
 
-		rs = cli.Cmd(cmd, args...)
+		rs = cli.CmdContext(ctx, cmd, args...)
 		if rs.Status != ResultNetworkException {
 			break
 		}
 
-		time.Sleep(time.Duration(try) * time.Second)
+		// never pooled while broken, re-dialed by the next attempt or
+		// the next use
+		cli.Close()
+
+		if try == 3 {
+			break
+		}
+
+		wait := time.Duration(try) * time.Second
+		if tto, ok := ctx.Deadline(); ok && time.Until(tto) < wait {
+			break
+		}
 
-		if cn, err := newClient(c.copts); err == nil {
-			cli.Close()
-			cli = cn
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			c.push(cli)
+			return newResult(ResultCanceled, ctx.Err())
 		}
+
+		c.pool.stats.retries.Add(1)
 	}
 
 	c.push(cli)
@@ -116,17 +293,40 @@ func (c *Connector) Cmd(cmd string, args ...interface{}) *Result {
 	return rs
 }
 
+// Close closes the idle connections and stops the pool, connections still
+// in use are closed when they are released.
 func (c *Connector) Close() {
-	for i := 0; i < c.cfg.MaxConn; i++ {
-		cli, _ := c.pull()
-		cli.Close()
+	if c.sentinel != nil {
+		c.sentinel.close()
+	}
+	if c.mux != nil {
+		c.mux.close()
 	}
+	c.pool.close()
 }
 
 func (c *Connector) push(cli *client) {
-	c.clients <- cli
+	c.pool.put(cli)
 }
 
-func (c *Connector) pull() (cli *client, err error) {
-	return <-c.clients, nil
+func (c *Connector) pull(ctx context.Context) (*client, error) {
+	cli, err := c.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cli.sock != nil && cli.gen != c.copts.generation() {
+		// re-dialed to the current address on next use
+		cli.Close()
+	}
+	return cli, nil
+}
+
+func pool_result(err error) *Result {
+	switch err {
+	case err_pool_timeout:
+		return newResult(ResultPoolTimeout, err)
+	case err_pool_closed:
+		return newResult(ResultNetworkException, err)
+	}
+	return newResult(ResultCanceled, err)
 }
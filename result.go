@@ -31,12 +31,38 @@ const (
 	ResultNetworkException
 	ResultTimeout
 	ResultUnknown
+	ResultCanceled
+	ResultPoolTimeout
+)
+
+// Kind is the RESP type of a reply.
+type Kind uint8
+
+const (
+	KindNone Kind = iota // not a reply, e.g. a network error
+	KindNil
+	KindString // simple string
+	KindBulk
+	KindInteger
+	KindArray
+	KindError
+	KindDouble
+	KindBool
+	KindBigNumber
+	KindVerbatim
+	KindMap
+	KindSet
+	KindPush
 )
 
 type Result struct {
 	Status uint8
 	data   []byte
 	cap    int
+	typ    byte
+	null   bool
+	err    error
+	attrs  *Result
 	Items  []*Result
 }
 
@@ -51,6 +77,7 @@ func newResult(status uint8, err error) *Result {
 			r.Status = ResultError
 		}
 		r.data = []byte(err.Error())
+		r.err = err
 	}
 
 	return r
@@ -64,6 +91,74 @@ func (r *Result) NotFound() bool {
 	return r.Status == ResultNotFound
 }
 
+// IsNil reports whether the reply is nil, e.g. GET of a missing key. An
+// empty string or array is not nil.
+func (r *Result) IsNil() bool {
+	return r.null
+}
+
+// Kind returns the RESP type of the reply.
+func (r *Result) Kind() Kind {
+	if r.null {
+		return KindNil
+	}
+	switch r.typ {
+	case '+':
+		return KindString
+	case '$':
+		return KindBulk
+	case ':':
+		return KindInteger
+	case '*':
+		return KindArray
+	case '-', '!':
+		return KindError
+	case ',':
+		return KindDouble
+	case '#':
+		return KindBool
+	case '(':
+		return KindBigNumber
+	case '=':
+		return KindVerbatim
+	case '%':
+		return KindMap
+	case '~':
+		return KindSet
+	case '>':
+		return KindPush
+	}
+	return KindNone
+}
+
+// Err returns nil if the command succeeded, or a *RedisError with the
+// prefix of the server error reply or the underlying transport error.
+func (r *Result) Err() error {
+
+	switch r.Status {
+	case 0, ResultOK, ResultNotFound:
+		return nil
+	}
+
+	if r.Status == ResultError && r.err == nil {
+		return newRedisError(string(r.data))
+	}
+
+	e := &RedisError{
+		Status:  r.Status,
+		Message: string(r.data),
+		Err:     r.err,
+	}
+
+	// e.g. the WRONGPASS reply of a failed AUTH
+	var se *RedisError
+	if errors.As(r.err, &se) {
+		e.Prefix = se.Prefix
+	}
+
+	return e
+}
+
 //
 func (r *Result) Bytes() []byte {
 	return r.data
@@ -156,6 +251,38 @@ func (r *Result) List() []*Result {
 	return r.Items
 }
 
+// IsMap reports whether the reply is a RESP3 map, its keys and values are
+// stored in Items as a flat list, in the same layout as HGETALL in RESP2.
+func (r *Result) IsMap() bool {
+	return r.typ == '%'
+}
+
+// IsSet reports whether the reply is a RESP3 set.
+func (r *Result) IsSet() bool {
+	return r.typ == '~'
+}
+
+// IsDouble reports whether the reply is a RESP3 double.
+func (r *Result) IsDouble() bool {
+	return r.typ == ','
+}
+
+// Map returns the key/value pairs of a map reply, or of any flat
+// key/value list such as HGETALL in RESP2.
+func (r *Result) Map() map[string]*Result {
+	m := make(map[string]*Result, r.KvLen())
+	for i := 1; i < len(r.Items); i += 2 {
+		m[r.Items[i-1].String()] = r.Items[i]
+	}
+	return m
+}
+
+// Attributes returns the RESP3 attribute map sent along with the reply,
+// or nil if there is none.
+func (r *Result) Attributes() *Result {
+	return r.attrs
+}
+
 func (r *Result) KvLen() int {
 	return len(r.Items) / 2
 }
@@ -0,0 +1,135 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"iter"
+)
+
+// ScanOptions are the options of Scan, SScan, HScan and ZScan.
+type ScanOptions struct {
+
+	// Glob-style pattern of the keys or members, leave blank to match all
+	Match string
+
+	// Number of elements the server returns per call, a hint only
+	Count int
+
+	// Type of the keys, e.g. "hash", Scan only
+	Type string
+}
+
+// Scan iterates over the keys of the database with SCAN, the cursor is
+// followed until the server ends it. An error ends the iteration and is
+// yielded as the last element.
+//
+//	for key, err := range conn.Scan(ctx, redisgo.ScanOptions{Match: "user:*"}) {
+//		if err != nil {
+//			return err
+//		}
+//	}
+func (c *Connector) Scan(ctx context.Context, opts ScanOptions) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		err := c.scan(ctx, "scan", "", opts, 1, func(ls []*Result) bool {
+			return yield(ls[0].String(), nil)
+		})
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// SScan iterates over the members of the set key with SSCAN.
+func (c *Connector) SScan(ctx context.Context, key string, opts ScanOptions) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		err := c.scan(ctx, "sscan", key, opts, 1, func(ls []*Result) bool {
+			return yield(ls[0].String(), nil)
+		})
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// HScan iterates over the fields of the hash key with HSCAN, Key and
+// Value of the entries are the field and its value.
+func (c *Connector) HScan(ctx context.Context, key string, opts ScanOptions) iter.Seq2[*ResultEntry, error] {
+	return c.scan_entries(ctx, "hscan", key, opts)
+}
+
+// ZScan iterates over the members of the sorted set key with ZSCAN, Key
+// and Value of the entries are the member and its score.
+func (c *Connector) ZScan(ctx context.Context, key string, opts ScanOptions) iter.Seq2[*ResultEntry, error] {
+	return c.scan_entries(ctx, "zscan", key, opts)
+}
+
+func (c *Connector) scan_entries(ctx context.Context, cmd, key string, opts ScanOptions) iter.Seq2[*ResultEntry, error] {
+	return func(yield func(*ResultEntry, error) bool) {
+		err := c.scan(ctx, cmd, key, opts, 2, func(ls []*Result) bool {
+			return yield(&ResultEntry{
+				Key:   ls[0].data,
+				Value: ls[1].data,
+			}, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// scan calls fn with every step elements of the replies of cmd until the
+// cursor ends or fn returns false.
+func (c *Connector) scan(ctx context.Context, cmd, key string, opts ScanOptions, step int, fn func(ls []*Result) bool) error {
+
+	cursor := "0"
+
+	for {
+
+		var args []interface{}
+		if cmd != "scan" {
+			args = append(args, key)
+		}
+		args = append(args, cursor)
+		if opts.Match != "" {
+			args = append(args, "match", opts.Match)
+		}
+		if opts.Count > 0 {
+			args = append(args, "count", opts.Count)
+		}
+		if opts.Type != "" && cmd == "scan" {
+			args = append(args, "type", opts.Type)
+		}
+
+		rs := c.CmdContext(ctx, cmd, args...)
+		if err := rs.Err(); err != nil {
+			return err
+		}
+		if len(rs.Items) != 2 {
+			return err_parse
+		}
+
+		ls := rs.Items[1].Items
+		for i := 0; i+step <= len(ls); i += step {
+			if !fn(ls[i : i+step]) {
+				return nil
+			}
+		}
+
+		if cursor = rs.Items[0].String(); cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Cmder is implemented by Connector and ClusterConnector.
+type Cmder interface {
+	CmdContext(ctx context.Context, cmd string, args ...interface{}) *Result
+}
+
+// Script is a Lua script run with EVALSHA, its SHA1 is computed locally.
+// The script is loaded with SCRIPT LOAD when the server replies NOSCRIPT,
+// and on every new connection if it is in Config.Scripts or was passed to
+// Connector.LoadScripts.
+type Script struct {
+	src  string
+	hash string
+}
+
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{
+		src:  src,
+		hash: hex.EncodeToString(h[:]),
+	}
+}
+
+// Hash returns the SHA1 digest of the script in hex.
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Source returns the Lua source of the script.
+func (s *Script) Source() string {
+	return s.src
+}
+
+// Run runs the script with EVALSHA. keys and args are passed as KEYS and
+// ARGV, a ClusterConnector routes the command by the first key.
+//
+//	rs := script.Run(conn, []string{"counter"}, 10)
+func (s *Script) Run(c Cmder, keys []string, args ...interface{}) *Result {
+	return s.RunContext(context.Background(), c, keys, args...)
+}
+
+func (s *Script) RunContext(ctx context.Context, c Cmder, keys []string, args ...interface{}) *Result {
+
+	cargs := make([]interface{}, 0, 2+len(keys)+len(args))
+	cargs = append(cargs, s.hash, len(keys))
+	for _, k := range keys {
+		cargs = append(cargs, k)
+	}
+	cargs = append(cargs, args...)
+
+	rs := c.CmdContext(ctx, "evalsha", cargs...)
+	if !errors.Is(rs.Err(), ErrNoScript) {
+		return rs
+	}
+
+	if err := s.LoadContext(ctx, c); err != nil {
+		return newResult(ResultError, err)
+	}
+
+	if rs = c.CmdContext(ctx, "evalsha", cargs...); !errors.Is(rs.Err(), ErrNoScript) {
+		return rs
+	}
+
+	// SCRIPT LOAD of a cluster may not have reached the node of the keys,
+	// EVAL caches the script on it
+	cargs[0] = s.src
+	return c.CmdContext(ctx, "eval", cargs...)
+}
+
+// Load loads the script into the script cache of the server.
+func (s *Script) Load(c Cmder) error {
+	return s.LoadContext(context.Background(), c)
+}
+
+func (s *Script) LoadContext(ctx context.Context, c Cmder) error {
+	rs := c.CmdContext(ctx, "script", "load", s.src)
+	if err := rs.Err(); err != nil {
+		return err
+	}
+	if rs.String() != s.hash {
+		return fmt.Errorf("script load: unexpected digest %q", rs.String())
+	}
+	return nil
+}
+
+// LoadScripts loads scripts now and on every new connection, so that
+// EVALSHA finds them after a restart or a failover of the server. They are
+// only kept for new connections if all of them were loaded.
+func (c *Connector) LoadScripts(scripts ...*Script) error {
+	for _, s := range scripts {
+		if err := s.Load(c); err != nil {
+			return err
+		}
+	}
+	c.copts.add_scripts(scripts)
+	return nil
+}
+
+// LoadScripts loads scripts on all of the known nodes now, and on every
+// new connection to any node if all of them were loaded.
+func (c *ClusterConnector) LoadScripts(scripts ...*Script) error {
+
+	c.mu.RLock()
+	nodes := make([]*Connector, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	c.mu.RUnlock()
+
+	for _, node := range nodes {
+		for _, s := range scripts {
+			if err := s.Load(node); err != nil {
+				return err
+			}
+		}
+	}
+
+	// nodes added since they were loaded copy the scripts from cfg, or
+	// catch up on them when they are inserted
+	c.mu.Lock()
+	c.cfg.Scripts = append(c.cfg.Scripts[:len(c.cfg.Scripts):len(c.cfg.Scripts)], scripts...)
+	nodes = nodes[:0]
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	c.mu.Unlock()
+
+	for _, node := range nodes {
+		node.copts.add_scripts(scripts)
+	}
+
+	return nil
+}
+
+func (o *connOptions) add_scripts(scripts []*Script) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.scripts = append(o.scripts[:len(o.scripts):len(o.scripts)], scripts...)
+}
+
+func (o *connOptions) script_list() []*Script {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.scripts
+}
@@ -0,0 +1,305 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	err_sentinel_master = errors.New("sentinel: master not found")
+
+	sentinel_cmd_readonly = map[string]bool{
+		"bitcount": true, "bitpos": true, "dbsize": true, "dump": true,
+		"exists": true, "geodist": true, "geohash": true, "geopos": true,
+		"georadius_ro": true, "georadiusbymember_ro": true,
+		"geosearch": true, "get": true, "getbit": true, "getrange": true,
+		"hexists": true, "hget": true, "hgetall": true, "hkeys": true,
+		"hlen": true, "hmget": true, "hrandfield": true, "hscan": true,
+		"hstrlen": true, "hvals": true, "keys": true, "lindex": true,
+		"llen": true, "lpos": true, "lrange": true, "mget": true,
+		"pfcount": true, "pttl": true, "randomkey": true, "scan": true,
+		"scard": true, "sdiff": true, "sinter": true, "sintercard": true,
+		"sismember": true, "smembers": true, "smismember": true,
+		"srandmember": true, "sscan": true, "strlen": true, "substr": true,
+		"sunion": true, "ttl": true, "type": true, "xlen": true,
+		"xrange": true, "xrevrange": true, "zcard": true, "zcount": true,
+		"zdiff": true, "zinter": true, "zlexcount": true, "zmscore": true,
+		"zrandmember": true, "zrange": true, "zrangebylex": true,
+		"zrangebyscore": true, "zrank": true, "zrevrange": true,
+		"zrevrangebylex": true, "zrevrangebyscore": true, "zrevrank": true,
+		"zscan": true, "zscore": true, "zunion": true,
+
+		// read-only scripts, see EVAL_RO and EVALSHA_RO
+		"eval_ro": true, "evalsha_ro": true,
+
+		"fcall_ro": true,
+	}
+)
+
+// sentinel discovers the master of a Connector from Redis Sentinel, and
+// follows +switch-master events to move the pool to the new master.
+type sentinel struct {
+	mu       sync.Mutex
+	cfg      Config
+	copts    *connOptions
+	watcher  *client
+	replicas []*Connector
+	next     uint32
+	closed   bool
+}
+
+func newSentinel(cfg Config, copts *connOptions) *sentinel {
+	return &sentinel{
+		cfg:   cfg,
+		copts: copts,
+	}
+}
+
+func (s *sentinel) dial(addr string) (*client, error) {
+	return newClient(&connOptions{
+		net:     "tcp",
+		addr:    addr,
+		timeout: s.copts.timeout,
+		auth:    s.cfg.SentinelAuth,
+		proto:   2,
+		tls:     s.copts.tls,
+	})
+}
+
+// master asks the sentinels in order for the address of the master.
+func (s *sentinel) master() (string, error) {
+
+	err := err_sentinel_master
+
+	for _, addr := range s.cfg.Sentinels {
+
+		cli, err2 := s.dial(addr)
+		if err2 != nil {
+			err = err2
+			continue
+		}
+
+		maddr, err2 := s.master_from(cli)
+		cli.Close()
+		if err2 == nil {
+			return maddr, nil
+		}
+		err = err2
+	}
+
+	return "", err
+}
+
+func (s *sentinel) master_from(cli *client) (string, error) {
+	rs := cli.Cmd("sentinel", "get-master-addr-by-name", s.cfg.MasterName)
+	if !rs.OK() || len(rs.Items) != 2 {
+		if rs.Status == ResultError {
+			return "", rs.Err()
+		}
+		return "", err_sentinel_master
+	}
+	return net.JoinHostPort(rs.Items[0].String(), rs.Items[1].String()), nil
+}
+
+func (s *sentinel) start() {
+	go s.watch()
+}
+
+// watch subscribes to +switch-master on one of the sentinels, and moves
+// on to the next one when the connection is lost.
+func (s *sentinel) watch() {
+
+	for i := 0; ; i++ {
+
+		if i > 0 && i%len(s.cfg.Sentinels) == 0 {
+			time.Sleep(s.copts.timeout)
+		}
+
+		if s.is_closed() {
+			return
+		}
+
+		cli, err := s.dial(s.cfg.Sentinels[i%len(s.cfg.Sentinels)])
+		if err != nil {
+			continue
+		}
+		if s.is_closed() {
+			cli.Close()
+			return
+		}
+
+		// the master may have changed while no sentinel was watched
+		if addr, err := s.master_from(cli); err == nil {
+			s.copts.set_address(addr)
+		}
+		if s.cfg.ReplicaRead {
+			s.replicas_refresh(cli)
+		}
+
+		if err := cli.write("subscribe", []string{"+switch-master"}); err != nil {
+			cli.Close()
+			continue
+		}
+		cli.sock.SetReadDeadline(time.Time{})
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			cli.Close()
+			return
+		}
+		s.watcher = cli
+		s.mu.Unlock()
+
+		for {
+			msg, err := cli.message()
+			if err != nil {
+				break
+			}
+			if msg == nil || msg.Kind != "message" {
+				continue
+			}
+
+			// <master name> <old ip> <old port> <new ip> <new port>
+			ss := strings.Fields(msg.Payload.String())
+			if len(ss) != 5 || ss[0] != s.cfg.MasterName {
+				continue
+			}
+			s.copts.set_address(net.JoinHostPort(ss[3], ss[4]))
+
+			if s.cfg.ReplicaRead {
+				if cli2, err := s.dial(s.cfg.Sentinels[i%len(s.cfg.Sentinels)]); err == nil {
+					if !s.is_closed() {
+						s.replicas_refresh(cli2)
+					}
+					cli2.Close()
+				}
+			}
+		}
+
+		s.mu.Lock()
+		s.watcher = nil
+		closed := s.closed
+		s.mu.Unlock()
+
+		cli.Close()
+		if closed {
+			return
+		}
+	}
+}
+
+// replicas_refresh rebuilds the replica pools from SENTINEL replicas,
+// replicas that are down or disconnected are skipped.
+func (s *sentinel) replicas_refresh(cli *client) {
+
+	rs := cli.Cmd("sentinel", "replicas", s.cfg.MasterName)
+	if !rs.OK() && !rs.NotFound() {
+		return
+	}
+
+	var replicas []*Connector
+
+	for _, v := range rs.Items {
+
+		m := v.Map()
+		if m["ip"] == nil || m["port"] == nil {
+			continue
+		}
+		if flags := m["flags"]; flags != nil {
+			if fs := flags.String(); strings.Contains(fs, "s_down") ||
+				strings.Contains(fs, "o_down") ||
+				strings.Contains(fs, "disconnected") {
+				continue
+			}
+		}
+
+		cfg := s.cfg
+		cfg.Host, cfg.Port, cfg.Socket = m["ip"].String(), m["port"].Uint16(), ""
+		cfg.Sentinels, cfg.ReplicaRead = nil, false
+		cfg.Hooks = s.copts.hook_list()
+
+		if rc, err := NewConnector(cfg); err == nil {
+			replicas = append(replicas, rc)
+		}
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		// closed meanwhile, the new pools are not needed
+		s.mu.Unlock()
+		for _, rc := range replicas {
+			rc.Close()
+		}
+		return
+	}
+	prev := s.replicas
+	s.replicas = replicas
+	s.mu.Unlock()
+
+	for _, rc := range prev {
+		// waits for the connections still in use
+		go rc.Close()
+	}
+}
+
+// add_hook adds h to the replica pools, replicas found later get it from
+// the master options.
+func (s *sentinel) add_hook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rc := range s.replicas {
+		rc.copts.add_hook(h)
+	}
+}
+
+// replica returns the next replica pool in round robin order, or nil.
+func (s *sentinel) replica() *Connector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.replicas) == 0 {
+		return nil
+	}
+	n := atomic.AddUint32(&s.next, 1)
+	return s.replicas[int(n)%len(s.replicas)]
+}
+
+func (s *sentinel) is_closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *sentinel) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+	for _, rc := range s.replicas {
+		go rc.Close()
+	}
+	s.replicas = nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testServer is a fake RESP2 server. handle gets the number of the
+// connection, from 1, and the command, and returns the raw reply. An
+// empty reply closes the connection.
+type testServer struct {
+	port  uint16
+	conns atomic.Int32
+}
+
+func newTestServer(t *testing.T, handle func(conn int, args []string) string) *testServer {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testServer{
+		port: uint16(ln.Addr().(*net.TCPAddr).Port),
+	}
+
+	go func() {
+		for {
+			sock, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(sock, int(s.conns.Add(1)), handle)
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) config() Config {
+	return Config{
+		Host: "127.0.0.1",
+		Port: s.port,
+	}
+}
+
+func (s *testServer) connector(t *testing.T) *Connector {
+	c, err := NewConnector(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (s *testServer) serve(sock net.Conn, conn int, handle func(conn int, args []string) string) {
+
+	defer sock.Close()
+
+	r := bufio.NewReader(sock)
+	for {
+		args, err := test_read_cmd(r)
+		if err != nil {
+			return
+		}
+		rep := handle(conn, args)
+		if rep == "" {
+			return
+		}
+		if _, err := sock.Write([]byte(rep)); err != nil {
+			return
+		}
+	}
+}
+
+// test_read_cmd reads a command sent as an array of bulk strings, the
+// name is lower cased.
+func test_read_cmd(r *bufio.Reader) ([]string, error) {
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		bs := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return nil, err
+		}
+		args[i] = string(bs[:size])
+	}
+	if n > 0 {
+		args[0] = strings.ToLower(args[0])
+	}
+
+	return args, nil
+}
+
+// test_reply parses a raw reply like a client does.
+func test_reply(t *testing.T, raw string) *Result {
+
+	t.Helper()
+
+	rs, _, err := test_parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+
+	return rs
+}
+
+// test_resp joins the lines of a reply with CRLF, a line starting with
+// "$ " is written as a bulk string of the rest of the line.
+func test_resp(lines ...string) string {
+	var buf strings.Builder
+	for _, line := range lines {
+		if s, ok := strings.CutPrefix(line, "$ "); ok {
+			line = "$" + strconv.Itoa(len(s)) + "\r\n" + s
+		}
+		buf.WriteString(line + "\r\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats is a snapshot of the counters of a Connector pool.
+type PoolStats struct {
+	Hits         uint64        // connections reused from the idle list
+	Misses       uint64        // new connections created by the pool
+	WaitCount    uint64        // times a caller waited for a free connection
+	WaitDuration time.Duration // total time spent waiting
+	Timeouts     uint64        // waits that ended with ResultPoolTimeout
+	Reconnects   uint64        // connections re-dialed after being closed
+	Retries      uint64        // commands retried after a network error
+
+	OpenConns  int
+	IdleConns  int
+	InUseConns int
+}
+
+type poolStats struct {
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	waits      atomic.Uint64
+	wait_ns    atomic.Uint64
+	timeouts   atomic.Uint64
+	reconnects atomic.Uint64
+	retries    atomic.Uint64
+}
+
+func (c *Connector) Stats() PoolStats {
+
+	p := c.pool
+
+	p.mu.Lock()
+	open, idle := p.open, len(p.idle)
+	p.mu.Unlock()
+
+	return PoolStats{
+		Hits:         p.stats.hits.Load(),
+		Misses:       p.stats.misses.Load(),
+		WaitCount:    p.stats.waits.Load(),
+		WaitDuration: time.Duration(p.stats.wait_ns.Load()),
+		Timeouts:     p.stats.timeouts.Load(),
+		Reconnects:   p.stats.reconnects.Load(),
+		Retries:      p.stats.retries.Load(),
+		OpenConns:    open,
+		IdleConns:    idle,
+		InUseConns:   open - idle,
+	}
+}
+
+// WritePrometheus writes the stats in the Prometheus text exposition
+// format, labeled with name="<name>" if name is not empty.
+func (s PoolStats) WritePrometheus(w io.Writer, name string) error {
+
+	label := ""
+	if name != "" {
+		label = "{name=" + strconv.Quote(name) + "}"
+	}
+
+	var buf bytes.Buffer
+
+	for _, m := range []struct {
+		name, typ, help string
+		value           interface{}
+	}{
+		{"hits_total", "counter", "Connections reused from the idle list.", s.Hits},
+		{"misses_total", "counter", "New connections created by the pool.", s.Misses},
+		{"waits_total", "counter", "Times a caller waited for a free connection.", s.WaitCount},
+		{"wait_seconds_total", "counter", "Total time spent waiting for a free connection.", s.WaitDuration.Seconds()},
+		{"timeouts_total", "counter", "Waits for a free connection that timed out.", s.Timeouts},
+		{"reconnects_total", "counter", "Connections re-dialed after being closed.", s.Reconnects},
+		{"retries_total", "counter", "Commands retried after a network error.", s.Retries},
+		{"open_connections", "gauge", "Open connections, idle and in use.", s.OpenConns},
+		{"idle_connections", "gauge", "Idle connections.", s.IdleConns},
+		{"in_use_connections", "gauge", "Connections in use.", s.InUseConns},
+	} {
+		fmt.Fprintf(&buf, "# HELP redisgo_pool_%s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE redisgo_pool_%s %s\n", m.name, m.typ)
+		fmt.Fprintf(&buf, "redisgo_pool_%s%s %v\n", m.name, label, m.value)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// StatsHandler serves the pool stats in the Prometheus text format, it can
+// be registered on the metrics endpoint scraped by Prometheus.
+func (c *Connector) StatsHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Stats().WritePrometheus(w, name)
+	})
+}
@@ -0,0 +1,291 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	err_scan_dst = errors.New("scan: dst must be a non-nil pointer to a struct")
+	err_scan_src = errors.New("scan: src must be a struct or a pointer to a struct")
+
+	struct_time_type   = reflect.TypeOf(time.Time{})
+	struct_fields_list sync.Map
+)
+
+type struct_field struct {
+	name      string
+	index     []int
+	omitempty bool
+}
+
+// ScanStruct copies a HGETALL reply, or any flat key/value list in Items,
+// into the fields of the struct pointed to by dst that are tagged with
+// `redis:"name"`. Strings, numbers, bools, []byte and time.Time are parsed
+// from their text, fields of any other type are decoded from JSON. Keys
+// without a field are ignored.
+func (r *Result) ScanStruct(dst interface{}) error {
+
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return err_scan_dst
+	}
+	rv = rv.Elem()
+
+	fields := struct_fields(rv.Type())
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for i := 1; i < len(r.Items); i += 2 {
+
+		key := r.Items[i-1].String()
+
+		for _, f := range fields {
+			if f.name != key {
+				continue
+			}
+			if err := struct_scan(struct_field_value(rv, f.index, true), r.Items[i].data); err != nil {
+				return fmt.Errorf("scan: field %s: %w", f.name, err)
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// StructArgs flattens the tagged fields of a struct into field and value
+// arguments of HSET, the mirror of Result.ScanStruct. Nil pointers and the
+// zero values of fields tagged with `redis:"name,omitempty"` are skipped.
+//
+//	args, err := redisgo.StructArgs(&user)
+//	conn.Cmd("hset", append([]interface{}{"user:1"}, args...)...)
+func StructArgs(src interface{}) ([]interface{}, error) {
+
+	rv := reflect.ValueOf(src)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, err_scan_src
+	}
+
+	var args []interface{}
+
+	for _, f := range struct_fields(rv.Type()) {
+
+		fv := struct_field_value(rv, f.index, false)
+		if !fv.IsValid() || (f.omitempty && fv.IsZero()) {
+			continue
+		}
+
+		v, err := struct_arg(fv)
+		if err != nil {
+			return nil, fmt.Errorf("scan: field %s: %w", f.name, err)
+		}
+		if v != nil {
+			args = append(args, f.name, v)
+		}
+	}
+
+	return args, nil
+}
+
+func struct_fields(t reflect.Type) []struct_field {
+
+	if v, ok := struct_fields_list.Load(t); ok {
+		return v.([]struct_field)
+	}
+
+	var ls []struct_field
+
+	for _, f := range reflect.VisibleFields(t) {
+		tag, ok := f.Tag.Lookup("redis")
+		if !ok || tag == "-" || !f.IsExported() || !struct_field_reachable(t, f.Index) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		ls = append(ls, struct_field{
+			name:      name,
+			index:     f.Index,
+			omitempty: opts == "omitempty",
+		})
+	}
+
+	struct_fields_list.Store(t, ls)
+
+	return ls
+}
+
+// struct_field_reachable reports false for a field promoted through an
+// embedded pointer to an unexported struct, like encoding/json it is
+// skipped as the pointer can not be allocated by reflect.
+func struct_field_reachable(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		if f := t.FieldByIndex(index[:i]); !f.IsExported() && f.Type.Kind() == reflect.Ptr {
+			return false
+		}
+	}
+	return true
+}
+
+// struct_field_value returns the field at index, embedded nil pointers on
+// the way are allocated if alloc is set, or an invalid Value is returned.
+func struct_field_value(rv reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, n := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(n)
+	}
+	return rv
+}
+
+func struct_scan(v reflect.Value, bs []byte) error {
+
+	if len(bs) == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Type() == struct_time_type {
+		tv, err := time.Parse(time.RFC3339Nano, string(bs))
+		if err != nil {
+			// unix time in seconds
+			n, err2 := strconv.ParseInt(string(bs), 10, 64)
+			if err2 != nil {
+				return err
+			}
+			tv = time.Unix(n, 0)
+		}
+		v.Set(reflect.ValueOf(tv))
+		return nil
+	}
+
+	switch v.Kind() {
+
+	case reflect.String:
+		v.SetString(string(bs))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(bs), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(bs), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(bs), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(string(bs))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return struct_scan(v.Elem(), bs)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(bytes_clone(bs))
+			return nil
+		}
+		return json.Unmarshal(bs, v.Addr().Interface())
+
+	default:
+		return json.Unmarshal(bs, v.Addr().Interface())
+	}
+
+	return nil
+}
+
+func struct_arg(v reflect.Value) (interface{}, error) {
+
+	if v.Type() == struct_time_type {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+
+	switch v.Kind() {
+
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+
+	case reflect.Float32:
+		return float32(v.Float()), nil
+
+	case reflect.Float64:
+		return v.Float(), nil
+
+	case reflect.Bool:
+		return v.Bool(), nil
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return struct_arg(v.Elem())
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+	}
+
+	return json.Marshal(v.Interface())
+}
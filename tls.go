@@ -0,0 +1,191 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var err_tls_ca = errors.New("tls: no certificate found in the CA file")
+
+// tlsLoader builds the tls.Config of new connections. Certificates set
+// by file are loaded again when one of the files is modified, so that
+// rotated certificates are used without restarting the Connector.
+type tlsLoader struct {
+	mu     sync.Mutex
+	base   *tls.Config
+	ca     string
+	cert   string
+	key    string
+	name   string
+	mtimes [3]time.Time
+	cfg    *tls.Config
+}
+
+func newTlsLoader(cfg Config) (*tlsLoader, error) {
+
+	if !cfg.TLS && cfg.TLSConfig == nil && cfg.TLSCAFile == "" &&
+		cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" && cfg.TLSServerName == "" {
+		return nil, nil
+	}
+
+	l := &tlsLoader{
+		base: cfg.TLSConfig,
+		ca:   cfg.TLSCAFile,
+		cert: cfg.TLSCertFile,
+		key:  cfg.TLSKeyFile,
+		name: cfg.TLSServerName,
+	}
+
+	if (l.cert == "") != (l.key == "") {
+		return nil, errors.New("tls: both cert and key files must be set")
+	}
+
+	if _, err := l.config(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// config returns the current tls.Config, loading the files again if they
+// were modified since the last call. The last good config is kept while
+// they fail to load, e.g. between the writes of a rotated cert and key.
+func (l *tlsLoader) config() (*tls.Config, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg, err := l.load(false)
+	if err != nil && l.cfg != nil {
+		return l.cfg, nil
+	}
+
+	return cfg, err
+}
+
+// reload loads the files again, the current config is kept if they fail
+// to load and the error is returned.
+func (l *tlsLoader) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.load(true)
+	return err
+}
+
+// load reads the files if they were modified, or always if force is set,
+// and replaces the cached config only on success.
+func (l *tlsLoader) load(force bool) (*tls.Config, error) {
+
+	var mtimes [3]time.Time
+	for i, path := range []string{l.ca, l.cert, l.key} {
+		if path == "" {
+			continue
+		}
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		mtimes[i] = st.ModTime()
+	}
+
+	if !force && l.cfg != nil && mtimes == l.mtimes {
+		return l.cfg, nil
+	}
+
+	var cfg *tls.Config
+	if l.base != nil {
+		cfg = l.base.Clone()
+	} else {
+		cfg = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	if l.name != "" {
+		cfg.ServerName = l.name
+	}
+
+	if l.ca != "" {
+		bs, err := os.ReadFile(l.ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return nil, err_tls_ca
+		}
+		cfg.RootCAs = pool
+	}
+
+	if l.cert != "" {
+		cert, err := tls.LoadX509KeyPair(l.cert, l.key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	l.cfg, l.mtimes = cfg, mtimes
+
+	return cfg, nil
+}
+
+// handshake runs the TLS client handshake on sock, bounded by timeout.
+func (l *tlsLoader) handshake(ctx context.Context, sock net.Conn,
+	addr string, timeout time.Duration) (net.Conn, error) {
+
+	cfg, err := l.config()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn := tls.Client(sock, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+
+	return conn, nil
+}
+
+// ReloadTLS loads the CA, certificate and key files again, new connections
+// use them from now on. If they fail to load, the error is returned and
+// the previous files are still used.
+func (c *Connector) ReloadTLS() error {
+	if c.copts.tls == nil {
+		return nil
+	}
+	return c.copts.tls.reload()
+}
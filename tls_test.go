@@ -0,0 +1,43 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTlsImplied(t *testing.T) {
+
+	if l, err := newTlsLoader(Config{}); l != nil || err != nil {
+		t.Fatalf("no TLS option: %v %v", l, err)
+	}
+
+	for _, cfg := range []Config{
+		{TLS: true},
+		{TLSConfig: &tls.Config{}},
+		{TLSServerName: "redis.local"},
+	} {
+		l, err := newTlsLoader(cfg)
+		if l == nil || err != nil {
+			t.Fatalf("%+v: plaintext, %v", cfg, err)
+		}
+	}
+
+	// a key without a cert is not silently ignored
+	if _, err := newTlsLoader(Config{TLSKeyFile: "client.key"}); err == nil {
+		t.Fatal("key file without a cert file")
+	}
+}
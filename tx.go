@@ -0,0 +1,344 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTxAborted is returned by Tx.Exec when EXEC replies with a nil
+	// array because one of the watched keys was modified.
+	ErrTxAborted = errors.New("transaction aborted")
+
+	// ErrTxConnLost is returned by Tx.Exec, and set on the results of
+	// Tx.Cmd, when the pinned connection was lost after the first command
+	// of the transaction, as its WATCH would not hold on a new one.
+	ErrTxConnLost = errors.New("transaction connection lost")
+
+	tx_retry_max = 10
+)
+
+// Tx is a MULTI/EXEC transaction. It holds one connection of the pool
+// until Close is called, so that WATCH, MULTI, the queued commands and
+// EXEC are all sent on the same socket.
+type Tx struct {
+	c     *Connector
+	cli   *client
+	buf   bytes.Buffer
+	rss   []*Result
+	evs   []*HookEvent
+	num   int
+	watch bool
+	sent  bool // a command was sent on cli, it must not be re-dialed
+}
+
+// Tx pins a connection of the pool for a transaction. The caller must
+// call Tx.Close to return it.
+func (c *Connector) Tx() (*Tx, error) {
+	return c.TxContext(context.Background())
+}
+
+func (c *Connector) TxContext(ctx context.Context) (*Tx, error) {
+	cli, err := c.pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{
+		c:   c,
+		cli: cli,
+	}, nil
+}
+
+// Transaction runs fn in a transaction that WATCHes keys. Commands queued
+// by fn with Tx.Queue are executed with EXEC after fn returns, and fn is
+// run again when EXEC aborts because a watched key was changed, or when the
+// connection was lost before EXEC was sent.
+func (c *Connector) Transaction(fn func(tx *Tx) error, keys ...string) ([]*Result, error) {
+
+	for try := 1; try <= tx_retry_max; try++ {
+
+		tx, err := c.Tx()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) > 0 {
+			if rs := tx.Watch(keys...); !rs.OK() {
+				tx.Close()
+				return nil, rs.Err()
+			}
+		}
+
+		if err := fn(tx); err != nil {
+			tx.Close()
+			return nil, err
+		}
+
+		ls, err := tx.Exec()
+		tx.Close()
+
+		if err != ErrTxAborted && err != ErrTxConnLost {
+			return ls, err
+		}
+	}
+
+	return nil, ErrTxAborted
+}
+
+func (t *Tx) Watch(keys ...string) *Result {
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	rs := t.Cmd("watch", args...)
+	if rs.OK() {
+		t.watch = true
+	}
+	return rs
+}
+
+func (t *Tx) Unwatch() *Result {
+	rs := t.Cmd("unwatch")
+	if rs.OK() {
+		t.watch = false
+	}
+	return rs
+}
+
+// Cmd runs a command on the pinned connection right away, outside of
+// MULTI. It is used to read watched keys before queuing the writes.
+func (t *Tx) Cmd(cmd string, args ...interface{}) *Result {
+	return t.CmdContext(context.Background(), cmd, args...)
+}
+
+func (t *Tx) CmdContext(ctx context.Context, cmd string, args ...interface{}) *Result {
+
+	if t.lost() {
+		return newResult(ResultNetworkException, ErrTxConnLost)
+	}
+	t.sent = true
+
+	hooks := t.c.copts.hook_list()
+	if len(hooks) == 0 {
+		return t.cli.CmdContext(ctx, cmd, args...)
+	}
+
+	ev := &HookEvent{
+		Cmd:  cmd,
+		Args: args,
+	}
+	ctx = hook_before_cmd(ctx, hooks, ev)
+
+	tn, nw, nr := time.Now(), t.cli.nw, t.cli.nread()
+	rs := t.cli.CmdContext(ctx, cmd, args...)
+	ev.Duration, ev.Status = time.Since(tn), rs.Status
+	ev.BytesWritten, ev.BytesRead = t.cli.nw-nw, t.cli.nread()-nr
+
+	hook_after_cmd(ctx, hooks, ev)
+
+	return rs
+}
+
+// Queue adds a command to be executed by Exec. Commands with bad
+// arguments are not sent, their slot in the Exec results is set to a
+// ResultBadArgument result.
+func (t *Tx) Queue(cmd string, args ...interface{}) *Tx {
+
+	t.evs = append(t.evs, &HookEvent{
+		Cmd:  cmd,
+		Args: args,
+	})
+
+	buf, err := send_buf_cmd(cmd, args)
+	if err != nil {
+		t.rss = append(t.rss, newResult(ResultBadArgument, err))
+		return t
+	}
+
+	t.buf.Write(buf)
+	t.rss = append(t.rss, nil)
+	t.evs[len(t.evs)-1].BytesWritten = int64(len(buf))
+	t.num++
+
+	return t
+}
+
+// Discard drops the commands queued so far.
+func (t *Tx) Discard() {
+	t.buf.Reset()
+	t.rss = nil
+	t.evs = nil
+	t.num = 0
+}
+
+// Exec sends MULTI, the queued commands and EXEC with a single write and
+// returns one Result per queued command. ErrTxAborted is returned when a
+// watched key was changed, any other error means the transaction was not
+// executed.
+func (t *Tx) Exec() ([]*Result, error) {
+	return t.ExecContext(context.Background())
+}
+
+func (t *Tx) ExecContext(ctx context.Context) ([]*Result, error) {
+
+	defer t.Discard()
+
+	hooks := t.c.copts.hook_list()
+	if len(hooks) == 0 {
+		return t.exec(ctx)
+	}
+
+	ctx = hook_before_pipeline(ctx, hooks, t.evs)
+
+	tn := time.Now()
+	rss, err := t.exec(ctx)
+
+	var status uint8
+	var rerr *RedisError
+	switch {
+	case err == nil:
+	case err == ErrTxAborted:
+		status = ResultNotFound
+	case errors.As(err, &rerr):
+		status = ResultError
+	case ctx_err(ctx) != nil:
+		status = ResultCanceled
+	default:
+		status = ResultNetworkException
+	}
+
+	for i, ev := range t.evs {
+		ev.Duration, ev.Err = time.Since(tn), err
+		if err != nil {
+			ev.Status = status
+		} else {
+			ev.Status = rss[i].Status
+		}
+	}
+
+	hook_after_pipeline(ctx, hooks, t.evs)
+
+	return rss, err
+}
+
+func (t *Tx) exec(ctx context.Context) ([]*Result, error) {
+
+	if t.lost() {
+		t.watch, t.sent = false, false
+		return nil, ErrTxConnLost
+	}
+
+	// EXEC ends the transaction, the connection holds no state after it
+	ls, err := t.cli.Exec(ctx, t.buf.Bytes(), t.num)
+	t.watch, t.sent = false, false
+	if err != nil {
+		return nil, err
+	}
+
+	rss := t.rss
+	for i, j := 0, 0; i < len(rss); i++ {
+		if rss[i] == nil {
+			rss[i], j = ls[j], j+1
+		}
+	}
+
+	return rss, nil
+}
+
+// Close releases the pinned connection back to the pool.
+func (t *Tx) Close() {
+	if t.cli == nil {
+		return
+	}
+	// a lost connection took its WATCH with it
+	if t.watch && !t.lost() {
+		t.Unwatch()
+	}
+	t.c.push(t.cli)
+	t.cli = nil
+}
+
+// lost reports whether the pinned connection was closed after a command
+// of the transaction was sent on it.
+func (t *Tx) lost() bool {
+	return t.sent && t.cli.sock == nil
+}
+
+var (
+	tx_cmd_multi, _ = send_buf_cmd("multi", nil)
+	tx_cmd_exec, _  = send_buf_cmd("exec", nil)
+)
+
+func (c *client) Exec(ctx context.Context, buf []byte, num int) ([]*Result, error) {
+
+	if rs := c.reconnect(ctx); rs != nil {
+		return nil, rs.Err()
+	}
+
+	var wbuf bytes.Buffer
+	wbuf.Write(tx_cmd_multi)
+	wbuf.Write(buf)
+	wbuf.Write(tx_cmd_exec)
+
+	done := c.deadline(ctx)
+	defer done()
+
+	c.nw += int64(wbuf.Len())
+	if _, err := c.sock.Write(wbuf.Bytes()); err != nil {
+		c.Close()
+		return nil, ctx_error(ctx, err)
+	}
+
+	// MULTI, then +QUEUED or an error for each queued command
+	var err_queue error
+	for i := 0; i <= num; i++ {
+		rs, err := c.cmd_parse()
+		if err != nil {
+			c.Close()
+			return nil, ctx_error(ctx, err)
+		}
+		if rs.Status == ResultError && err_queue == nil {
+			err_queue = rs.Err()
+		}
+	}
+
+	rs, err := c.cmd_parse()
+	if err != nil {
+		c.Close()
+		return nil, ctx_error(ctx, err)
+	}
+
+	switch {
+
+	case rs.Status == ResultError:
+		if err_queue != nil {
+			return nil, err_queue
+		}
+		return nil, rs.Err()
+
+	case rs.IsNil():
+		return nil, ErrTxAborted
+
+	case rs.Kind() == KindArray && len(rs.Items) == num:
+		return rs.Items, nil
+	}
+
+	c.Close()
+	return nil, err_parse
+}
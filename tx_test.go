@@ -0,0 +1,121 @@
+// Copyright 2014 Eryx <evorui аt gmаil dοt cοm>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisgo // import "github.com/lynkdb/redisgo"
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// txTestServer drops the first connection on its first GET, the others
+// reply like a server where the watched key is not modified.
+func txTestServer(t *testing.T) (*testServer, func() []string) {
+
+	var (
+		mu  sync.Mutex
+		log []string
+	)
+
+	s := newTestServer(t, func(conn int, args []string) string {
+		mu.Lock()
+		log = append(log, strings.Join(append([]string{strconv.Itoa(conn)}, args...), " "))
+		mu.Unlock()
+		switch args[0] {
+		case "get":
+			if conn == 1 {
+				return ""
+			}
+			return "$1\r\n1\r\n"
+		case "multi", "watch", "unwatch":
+			return "+OK\r\n"
+		case "set":
+			return "+QUEUED\r\n"
+		case "exec":
+			return "*1\r\n+OK\r\n"
+		}
+		return "+PONG\r\n"
+	})
+
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, log...)
+	}
+}
+
+func TestTxConnLost(t *testing.T) {
+
+	s, log := txTestServer(t)
+	c := s.connector(t)
+
+	tx, err := c.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs := tx.Watch("k"); !rs.OK() {
+		t.Fatal(rs.Err())
+	}
+	if rs := tx.Cmd("get", "k"); rs.Status != ResultNetworkException {
+		t.Fatalf("get status %d", rs.Status)
+	}
+	if rs := tx.Cmd("get", "k"); !errors.Is(rs.Err(), ErrTxConnLost) {
+		t.Fatalf("get after the drop: %v", rs.Err())
+	}
+
+	tx.Queue("set", "k", "2")
+	if _, err := tx.Exec(); err != ErrTxConnLost {
+		t.Fatalf("exec: %v", err)
+	}
+	tx.Close()
+
+	if n := s.conns.Load(); n != 1 {
+		t.Fatalf("%d connections, the pinned one was re-dialed", n)
+	}
+	if ls := log(); len(ls) != 2 {
+		t.Fatalf("commands %q", ls)
+	}
+}
+
+func TestTransactionConnLost(t *testing.T) {
+
+	s, log := txTestServer(t)
+	c := s.connector(t)
+
+	runs := 0
+	ls, err := c.Transaction(func(tx *Tx) error {
+		runs++
+		n := tx.Cmd("get", "k").Int()
+		tx.Queue("set", "k", n+1)
+		return nil
+	}, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 || len(ls) != 1 || !ls[0].OK() {
+		t.Fatalf("runs %d results %v", runs, ls)
+	}
+
+	want := []string{
+		"1 watch k", "1 get k",
+		"2 watch k", "2 get k", "2 multi", "2 set k 2", "2 exec",
+	}
+	if got := log(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("commands %q, want %q", got, want)
+	}
+}